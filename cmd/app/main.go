@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	_ "github.com/koan6gi/go-drive/docs"
 
@@ -13,10 +16,22 @@ import (
 // @description API for file operations
 // @host localhost:8080
 // @BasePath /
-// @schemes http
+// @schemes http https
 // @openapi 3.0.0
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Bearer token configured in auth.tokens or GO_DRIVE_TOKENS
 func main() {
-	err := app.Run()
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		err = app.Reconcile(os.Args[2:])
+	} else {
+		err = app.Run(os.Args[1:])
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/koan6gi/go-drive/internal/app/drivectl"
+)
+
+func main() {
+	err := drivectl.Run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "drivectl:", err)
+		os.Exit(1)
+	}
+}
@@ -15,37 +15,37 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/copy": {
-            "put": {
-                "description": "Copy file or directory from source to destination",
+        "/archive": {
+            "post": {
+                "description": "Start background packing of file or directory into zip archive",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
                     "Files"
                 ],
-                "summary": "Copy file/directory",
+                "summary": "Create archive",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Source path",
+                        "description": "File or directory path",
                         "name": "src",
                         "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Destination path",
+                        "description": "Archive path",
                         "name": "dest",
                         "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "copy success",
+                    "202": {
+                        "description": "Started job",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/jobs.Job"
                         }
                     },
                     "400": {
@@ -54,6 +54,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -63,30 +69,56 @@ const docTemplate = `{
                 }
             }
         },
-        "/delete": {
-            "delete": {
-                "description": "Delete file or directory at specified path",
+        "/audit": {
+            "get": {
+                "description": "Get audited operations, newest first, available to administrators only",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Files"
+                    "Admin"
                 ],
-                "summary": "Delete file/directory",
+                "summary": "Query audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Path to delete",
-                        "name": "path",
-                        "in": "query",
-                        "required": true
+                        "description": "User name",
+                        "name": "user",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Path prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start time, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End time, RFC 3339, exclusive",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records, default 1000",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "delete success",
+                        "description": "Audit records",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/audit.Record"
+                            }
                         }
                     },
                     "400": {
@@ -95,6 +127,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -104,71 +142,99 @@ const docTemplate = `{
                 }
             }
         },
-        "/directory": {
+        "/batch": {
             "post": {
-                "description": "Create new directory at specified path",
+                "description": "Execute delete, move, copy and mkdir operations in order under a single storage lock.\nFailed operations don't stop the batch unless it is transactional, then all changes are rolled back.\nOverwriting files is not supported in transactional batches.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Directories"
+                    "Files"
                 ],
-                "summary": "Create directory",
+                "summary": "Batch operations",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Directory path to create",
-                        "name": "path",
-                        "in": "query",
-                        "required": true
+                        "description": "Operations",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/gateway.BatchRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "create directory success",
+                        "description": "Results of operations",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/gateway.BatchResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Transactional batch failed",
+                        "schema": {
+                            "$ref": "#/definitions/gateway.BatchResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Transactional batch failed",
+                        "schema": {
+                            "$ref": "#/definitions/gateway.BatchResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Transactional batch failed",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/gateway.BatchResponse"
                         }
                     }
                 }
             }
         },
-        "/download": {
+        "/changes": {
             "get": {
-                "description": "Download file from specified path",
+                "description": "Get changes recorded after cursor in order. Without cursor returns the current cursor to start from.\n410 with resetRequired means the cursor is too old and the client has to relist the tree.",
                 "produces": [
-                    "application/octet-stream"
+                    "application/json"
                 ],
                 "tags": [
-                    "Files"
+                    "Events"
                 ],
-                "summary": "Download file",
+                "summary": "List changes",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "File path to download",
-                        "name": "path",
-                        "in": "query",
-                        "required": true
+                        "description": "Cursor returned by previous call",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Directory to get changes of",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of changes",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "File content",
+                        "description": "Changes and the next cursor",
                         "schema": {
-                            "type": "file"
+                            "$ref": "#/definitions/repository.ChangeSet"
                         }
                     },
                     "400": {
@@ -177,6 +243,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "410": {
+                        "description": "Reset required",
+                        "schema": {
+                            "$ref": "#/definitions/repository.ChangeSet"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -186,33 +258,56 @@ const docTemplate = `{
                 }
             }
         },
-        "/list": {
-            "get": {
-                "description": "Get list of files/directories in specified path",
+        "/copy": {
+            "put": {
+                "description": "Copy file or directory from source to destination",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Directories"
+                    "Files"
                 ],
-                "summary": "List directory contents",
+                "summary": "Copy file/directory",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Directory path to list",
-                        "name": "path",
+                        "description": "Source path",
+                        "name": "src",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Destination path",
+                        "name": "dest",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "fail",
+                        "description": "Existing file handling: fail, overwrite, rename or skip",
+                        "name": "onConflict",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Run as background job",
+                        "name": "async",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "List of files/directories",
+                        "description": "Final path of the file",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/repository.Placement"
+                        }
+                    },
+                    "202": {
+                        "description": "Started job",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
                         }
                     },
                     "400": {
@@ -221,6 +316,24 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -230,35 +343,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/move": {
-            "put": {
-                "description": "Move file or directory from source to destination",
+        "/delete": {
+            "delete": {
+                "description": "Delete file or directory at specified path",
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
                     "Files"
                 ],
-                "summary": "Move file/directory",
+                "summary": "Delete file/directory",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Source path",
-                        "name": "src",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Destination path",
-                        "name": "dest",
+                        "description": "Path to delete",
+                        "name": "path",
                         "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "move success",
+                        "description": "delete success",
                         "schema": {
                             "type": "string"
                         }
@@ -269,6 +375,18 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -278,30 +396,46 @@ const docTemplate = `{
                 }
             }
         },
-        "/update": {
-            "put": {
-                "description": "Update existing file content",
-                "consumes": [
-                    "multipart/form-data"
+        "/diag": {
+            "get": {
+                "description": "Get tree size, lock contention, open file handles and backend status, available to administrators only",
+                "produces": [
+                    "application/json"
                 ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Storage diagnostics",
+                "responses": {
+                    "200": {
+                        "description": "Diagnostics",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Diagnostics"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/directory": {
+            "post": {
+                "description": "Create new directory at specified path",
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "Files"
+                    "Directories"
                 ],
-                "summary": "Update file",
+                "summary": "Create directory",
                 "parameters": [
-                    {
-                        "type": "file",
-                        "description": "New file content",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
-                    },
                     {
                         "type": "string",
-                        "description": "File path to update",
+                        "description": "Directory path to create",
                         "name": "path",
                         "in": "query",
                         "required": true
@@ -309,7 +443,7 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "file update success",
+                        "description": "create directory success",
                         "schema": {
                             "type": "string"
                         }
@@ -320,6 +454,24 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -329,40 +481,42 @@ const docTemplate = `{
                 }
             }
         },
-        "/upload": {
-            "post": {
-                "description": "Upload a file to the specified path",
-                "consumes": [
-                    "multipart/form-data"
-                ],
+        "/download": {
+            "get": {
+                "description": "Download file from specified path with detected content type.\nInline content is shown by browsers, documents able to run scripts are sandboxed",
                 "produces": [
-                    "text/plain"
+                    "application/octet-stream"
                 ],
                 "tags": [
                     "Files"
                 ],
-                "summary": "Upload file",
+                "summary": "Download file",
                 "parameters": [
-                    {
-                        "type": "file",
-                        "description": "File to upload",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
-                    },
                     {
                         "type": "string",
-                        "description": "Destination path",
+                        "description": "File path to download",
                         "name": "path",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Show in browser instead of saving",
+                        "name": "inline",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "file upload success",
+                        "description": "File content",
                         "schema": {
-                            "type": "string"
+                            "type": "file"
+                        },
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "SHA-256 of the whole file"
+                            }
                         }
                     },
                     "400": {
@@ -371,6 +525,18 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -379,6 +545,1476 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/events": {
+            "get": {
+                "description": "Stream change events inside prefix as Server-Sent Events, a \"reset\" event means some changes were lost",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Events"
+                ],
+                "summary": "Change feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Directory to watch",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event ID, Last-Event-ID header is also accepted",
+                        "name": "lastEventId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "$ref": "#/definitions/events.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/events/ws": {
+            "get": {
+                "description": "Stream change events inside prefix as JSON WebSocket messages, a message of type \"reset\" means some changes were lost",
+                "tags": [
+                    "Events"
+                ],
+                "summary": "Change feed over WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Directory to watch",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event ID",
+                        "name": "lastEventId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Event stream",
+                        "schema": {
+                            "$ref": "#/definitions/events.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/extract": {
+            "post": {
+                "description": "Start background extraction of zip, tar or tar.gz archive into destination directory\nFinal paths of extracted files are listed in placements of the job\nExtraction isn't atomic, entries written before a failure stay in destination and are listed in placements",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Files"
+                ],
+                "summary": "Extract archive",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Archive path",
+                        "name": "src",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Destination directory",
+                        "name": "dest",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "fail",
+                        "description": "Existing file handling: fail, overwrite, rename or skip",
+                        "name": "onConflict",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Started job",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Report that the process is alive, no authentication required",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "get": {
+                "description": "Get states of background jobs started by the caller",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "List jobs",
+                "responses": {
+                    "200": {
+                        "description": "Jobs",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/jobs.Job"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}": {
+            "get": {
+                "description": "Get state of background job",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Get job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Job state",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Request cancellation of running background job",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Cancel job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Job state",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/list": {
+            "get": {
+                "description": "Get list of files/directories in specified path",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Directories"
+                ],
+                "summary": "List directory contents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Directory path to list",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of files/directories",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/move": {
+            "put": {
+                "description": "Move file or directory from source to destination",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Files"
+                ],
+                "summary": "Move file/directory",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Source path",
+                        "name": "src",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Destination path",
+                        "name": "dest",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "fail",
+                        "description": "Existing file handling: fail, overwrite, rename or skip",
+                        "name": "onConflict",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Run as background job",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Final path of the file",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Placement"
+                        }
+                    },
+                    "202": {
+                        "description": "Started job",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Check that storage directory is writable, metadata is loaded, free space is above threshold and the server is not shutting down, no authentication required",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "Ready",
+                        "schema": {
+                            "$ref": "#/definitions/gateway.Readiness"
+                        }
+                    },
+                    "503": {
+                        "description": "Not ready",
+                        "schema": {
+                            "$ref": "#/definitions/gateway.Readiness"
+                        }
+                    }
+                }
+            }
+        },
+        "/stat": {
+            "get": {
+                "description": "Get information about file or directory at specified path",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Directories"
+                ],
+                "summary": "Get file or directory information",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File or directory path",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File or directory information",
+                        "schema": {
+                            "$ref": "#/definitions/repository.DirEntry"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/thumbnail": {
+            "get": {
+                "description": "Get thumbnail of JPEG, PNG, GIF or WebP image fitting into a square of the size.\nJPEG images get JPEG thumbnails, others get PNG.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png"
+                ],
+                "tags": [
+                    "Files"
+                ],
+                "summary": "Get image thumbnail",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image path",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            64,
+                            128,
+                            256,
+                            512
+                        ],
+                        "type": "integer",
+                        "default": 256,
+                        "description": "Thumbnail size",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Thumbnail",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/update": {
+            "put": {
+                "description": "Update existing file content",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Files"
+                ],
+                "summary": "Update file",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "New file content",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File path to update",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256 of the file as sha-256=:base64:, Digest header is also accepted",
+                        "name": "Repr-Digest",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "file update success",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "SHA-256 of the stored file"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload": {
+            "post": {
+                "description": "Upload a file to the specified path",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Files"
+                ],
+                "summary": "Upload file",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "File to upload",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Destination path",
+                        "name": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "fail",
+                        "description": "Existing file handling: fail, overwrite, rename or skip",
+                        "name": "onConflict",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256 of the file as sha-256=:base64:, Digest header is also accepted",
+                        "name": "Repr-Digest",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Final path of the file",
+                        "schema": {
+                            "$ref": "#/definitions/repository.Placement"
+                        },
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "SHA-256 of the stored file"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "Get webhooks registered by the caller",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "Webhooks",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.Hook"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register URL receiving HMAC signed change events for paths inside prefix.\nThe signature covers the timestamp header, a dot and the body. Internal addresses are refused",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Register webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook",
+                        "name": "hook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/gateway.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Registered webhook with secret",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.Hook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "delete": {
+                "description": "Delete webhook registered by the caller",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "delete success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Get delivery log of webhook registered by the caller, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deliveries",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.Delivery"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "audit.Record": {
+            "type": "object",
+            "properties": {
+                "dest": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "operation": {
+                    "type": "string"
+                },
+                "outcome": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "remote": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "user": {
+                    "type": "string"
+                }
+            }
+        },
+        "events.Event": {
+            "type": "object",
+            "properties": {
+                "external": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "itemType": {
+                    "type": "string"
+                },
+                "oldPath": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "user": {
+                    "type": "string"
+                }
+            }
+        },
+        "gateway.BatchOperation": {
+            "type": "object",
+            "properties": {
+                "dest": {
+                    "type": "string"
+                },
+                "onConflict": {
+                    "type": "string",
+                    "enum": [
+                        "fail",
+                        "overwrite",
+                        "rename",
+                        "skip"
+                    ]
+                },
+                "op": {
+                    "type": "string",
+                    "enum": [
+                        "delete",
+                        "move",
+                        "copy",
+                        "mkdir"
+                    ]
+                },
+                "path": {
+                    "type": "string"
+                },
+                "src": {
+                    "type": "string"
+                }
+            }
+        },
+        "gateway.BatchRequest": {
+            "type": "object",
+            "properties": {
+                "operations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gateway.BatchOperation"
+                    }
+                },
+                "transactional": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "gateway.BatchResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gateway.BatchResult"
+                    }
+                },
+                "rolledBack": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "gateway.BatchResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "op": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "skipped": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "gateway.Readiness": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "gateway.WebhookRequest": {
+            "type": "object",
+            "properties": {
+                "prefix": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "jobs.Job": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "placements": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/jobs.Placement"
+                    }
+                },
+                "progress": {
+                    "$ref": "#/definitions/jobs.Progress"
+                },
+                "result": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "jobs.Placement": {
+            "type": "object",
+            "properties": {
+                "overwritten": {
+                    "type": "boolean"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "skipped": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "jobs.Progress": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.ChangeSet": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/events.Event"
+                    }
+                },
+                "cursor": {
+                    "type": "string"
+                },
+                "hasMore": {
+                    "type": "boolean"
+                },
+                "resetRequired": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "repository.Compression": {
+            "type": "string",
+            "enum": [
+                "none",
+                "gzip",
+                "zstd"
+            ],
+            "x-enum-varnames": [
+                "CompressionNone",
+                "CompressionGzip",
+                "CompressionZstd"
+            ]
+        },
+        "repository.Diagnostics": {
+            "type": "object",
+            "properties": {
+                "backend": {
+                    "type": "string"
+                },
+                "compression": {
+                    "$ref": "#/definitions/repository.Compression"
+                },
+                "dataDirectory": {
+                    "type": "string"
+                },
+                "disk": {
+                    "$ref": "#/definitions/repository.DiskDiagnostics"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "lock": {
+                    "$ref": "#/definitions/repository.LockDiagnostics"
+                },
+                "metadata": {
+                    "$ref": "#/definitions/repository.MetadataDiagnostics"
+                },
+                "naming": {
+                    "$ref": "#/definitions/repository.NamePolicy"
+                },
+                "openFiles": {
+                    "type": "integer"
+                },
+                "processFileHandles": {
+                    "type": "integer"
+                },
+                "ready": {
+                    "type": "boolean"
+                },
+                "root": {
+                    "type": "string"
+                },
+                "scrub": {
+                    "$ref": "#/definitions/repository.ScrubReport"
+                },
+                "tree": {
+                    "$ref": "#/definitions/repository.Stats"
+                },
+                "treeCountedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.DirEntry": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "type": "string"
+                },
+                "contentType": {
+                    "type": "string"
+                },
+                "modTime": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.DiskDiagnostics": {
+            "type": "object",
+            "properties": {
+                "freeBytes": {
+                    "type": "integer"
+                },
+                "totalBytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.LockDiagnostics": {
+            "type": "object",
+            "properties": {
+                "acquisitions": {
+                    "type": "integer"
+                },
+                "heldForSeconds": {
+                    "type": "number"
+                },
+                "waitMaxSeconds": {
+                    "type": "number"
+                },
+                "waitTotalSeconds": {
+                    "type": "number"
+                },
+                "waiting": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.MetadataDiagnostics": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "file": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "integer"
+                },
+                "journal": {
+                    "type": "integer"
+                },
+                "lastChangeId": {
+                    "type": "integer"
+                },
+                "openTransactions": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.NamePolicy": {
+            "type": "string",
+            "enum": [
+                "sensitive",
+                "insensitive",
+                "preserving"
+            ],
+            "x-enum-varnames": [
+                "CaseSensitive",
+                "CaseInsensitive",
+                "CasePreserving"
+            ]
+        },
+        "repository.Placement": {
+            "type": "object",
+            "properties": {
+                "overwritten": {
+                    "type": "boolean"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "skipped": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "repository.ScrubMismatch": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "expected": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.ScrubReport": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "integer"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "mismatches": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/repository.ScrubMismatch"
+                    }
+                },
+                "running": {
+                    "type": "boolean"
+                },
+                "skipped": {
+                    "type": "integer"
+                },
+                "startedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.Stats": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "type": "integer"
+                },
+                "directories": {
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "integer"
+                },
+                "storedBytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "webhooks.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "eventId": {
+                    "type": "integer"
+                },
+                "eventType": {
+                    "type": "string"
+                },
+                "hookId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "statusCode": {
+                    "type": "integer"
+                },
+                "success": {
+                    "type": "boolean"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhooks.Hook": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "Bearer token configured in auth.tokens or GO_DRIVE_TOKENS",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -388,7 +2024,7 @@ var SwaggerInfo = &swag.Spec{
 	Version:          "1.0",
 	Host:             "localhost:8080",
 	BasePath:         "/",
-	Schemes:          []string{"http"},
+	Schemes:          []string{"http", "https"},
 	Title:            "File Storage API",
 	Description:      "API for file operations",
 	InfoInstanceName: "swagger",
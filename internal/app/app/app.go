@@ -1,23 +1,200 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/audit"
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/config"
+	"github.com/koan6gi/go-drive/internal/events"
 	"github.com/koan6gi/go-drive/internal/gateway"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	"github.com/koan6gi/go-drive/internal/metrics"
 	"github.com/koan6gi/go-drive/internal/repository"
+	"github.com/koan6gi/go-drive/internal/thumbnail"
+	"github.com/koan6gi/go-drive/internal/tracing"
+	"github.com/koan6gi/go-drive/internal/webhooks"
 )
 
 const (
-	addr = ":8080"
+	webhookWorkers      = 4
+	tracingFlushTimeout = 5 * time.Second
 )
 
-func Run() error {
-	var err error
-	repository.FileStorage, err = repository.NewFileStorage()
+func Run(args []string) error {
+	cfg, printConfig, err := config.Load("go-drive", args)
+	if err != nil {
+		return err
+	}
+	if printConfig {
+		return cfg.Print(os.Stdout)
+	}
+	configure(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("can't flush traces: %v", err)
+		}
+	}()
+
+	events.EventBus = events.NewBus()
+
+	storage, err := repository.NewFileStorage()
+	if err != nil {
+		return err
+	}
+	repository.FileStorage = repository.Instrument(storage)
+	metrics.Registry.MustRegister(repository.NewStatsCollector(storage))
+	events.EventBus.SetLastID(storage.LastChangeID())
+	if id, lost := storage.LostChangesAfter(); lost {
+		events.EventBus.SetLostAfter(id)
+	}
+
+	jobs.JobManager, err = jobs.NewManager(filepath.Join(repository.DataDirectory, "jobs.json"))
+	if err != nil {
+		storage.Close()
+		return err
+	}
+
+	webhooks.HookManager, err = webhooks.NewManager(filepath.Join(repository.DataDirectory, "webhooks.json"), cfg.WebhookNetworks())
+	if err != nil {
+		storage.Close()
+		return err
+	}
+
+	thumbnail.Thumbnails, err = thumbnail.NewManager(filepath.Join(repository.DataDirectory, "thumbnails"))
+	if err != nil {
+		storage.Close()
+		return err
+	}
+	repository.InvalidateDerived = thumbnail.Thumbnails.Invalidate
+
+	auditFile := cfg.Log.AuditFile
+	if auditFile == "" {
+		auditFile = filepath.Join(repository.DataDirectory, "audit.log")
+	}
+	audit.AuditLog, err = audit.Open(auditFile)
+	if err != nil {
+		storage.Close()
+		return err
+	}
+	defer audit.AuditLog.Close()
+
+	// background workers are stopped after active requests and jobs are finished
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := sync.WaitGroup{}
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		err := storage.Watch(workersCtx, cfg.Storage.RescanInterval)
+		if err != nil {
+			log.Printf("storage watcher stopped: %v", err)
+		}
+	}()
+	go func() {
+		defer workers.Done()
+		storage.Compressor(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		webhooks.HookManager.Run(workersCtx, events.EventBus, webhookWorkers)
+	}()
+	go func() {
+		defer workers.Done()
+		thumbnail.Thumbnails.Run(workersCtx, events.EventBus, cfg.Storage.ThumbnailWorkers)
+	}()
+	if cfg.Storage.ScrubInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := storage.Scrub(workersCtx, cfg.Storage.ScrubInterval); err != nil {
+				log.Printf("storage scrubber stopped: %v", err)
+			}
+		}()
+	}
 
 	router := gateway.NewRouter()
 	gateway.SetupRouter(router)
 
-	return gateway.ListenAndServe(addr, router)
+	err = gateway.ListenAndServe(ctx, cfg, router)
+	stop()
+
+	jobsCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	jobs.JobManager.Shutdown(jobsCtx)
+
+	stopWorkers()
+	workers.Wait()
+
+	storage.Lock()
+	defer storage.Unlock()
+	if cerr := storage.Close(); cerr != nil {
+		return errors.Join(err, cerr)
+	}
+
+	log.Printf("shutdown complete")
+	return err
+}
+
+// Reconcile rescans the storage directory and rebuilds the metadata index
+func Reconcile(args []string) error {
+	cfg, printConfig, err := config.Load("go-drive reconcile", args)
+	if err != nil {
+		return err
+	}
+	if printConfig {
+		return cfg.Print(os.Stdout)
+	}
+	configure(cfg)
+
+	storage, err := repository.NewFileStorage()
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	return storage.Reconcile()
+}
+
+// configure applies configuration to package settings
+func configure(cfg *config.Config) {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Log.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Log.Format == config.LogFormatText {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	}
+
+	repository.StorageDirectory = filepath.Clean(cfg.Storage.Root)
+	repository.DataDirectory = filepath.Clean(cfg.Storage.DataDir)
+	repository.MinFreeSpace = cfg.Storage.MinFreeSpace
+	repository.Naming = repository.NamePolicy(cfg.Storage.Naming)
+	repository.Compress = repository.Compression(cfg.Storage.Compression)
+	gateway.MaxFileSize = cfg.Storage.MaxFileSize
+	auth.Tokens = cfg.TokenMap()
+	auth.Permissions = cfg.Auth.Permissions
+	auth.Admins = make(map[string]bool)
+	for _, v := range cfg.Auth.Admins {
+		auth.Admins[v] = true
+	}
 }
@@ -0,0 +1,64 @@
+package drivectl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// Environment variables overriding the config file
+const (
+	envServer = "DRIVECTL_SERVER"
+	envToken  = "DRIVECTL_TOKEN"
+	envConfig = "DRIVECTL_CONFIG"
+)
+
+type config struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+}
+
+func defaultConfigPath() string {
+	if v := os.Getenv(envConfig); v != "" {
+		return v
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "drivectl", "config.yaml")
+}
+
+// loadConfig reads the config file and applies environment variables, missing file is not an error
+func loadConfig(path string) (*config, error) {
+	cfg := &config{
+		Server: defaultServer,
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if v := os.Getenv(envServer); v != "" {
+		cfg.Server = v
+	}
+	if v := os.Getenv(envToken); v != "" {
+		cfg.Token = v
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,384 @@
+package drivectl
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/koan6gi/go-drive/pkg/client"
+)
+
+const usage = `Usage: drivectl [flags] <command> [args]
+
+Commands:
+  ls [path]                 list directory
+  stat <path>               show file or directory information
+  mkdir <path>              create directory
+  rm <path>                 delete file or directory
+  mv [-on-conflict policy] <src> <dir>
+                            move file into directory
+  cp [-on-conflict policy] <src> <dir>
+                            copy file into directory
+  put [-r] [-on-conflict policy] <local> <remote>
+                            upload file or directory
+  get [-r] <remote> <local> download file or directory
+  sync [-direction up|down|both] [-dry-run] [-state file] <local> <remote>
+                            synchronize local directory with remote one
+
+Existing remote files are handled by -on-conflict policy: fail, overwrite, rename or skip.
+
+Flags:
+`
+
+type command struct {
+	c   *client.Client
+	ctx context.Context
+}
+
+// Run executes drivectl with command line arguments without program name
+func Run(args []string) error {
+	fs := flag.NewFlagSet("drivectl", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath(), "config file")
+	server := fs.String("server", "", "server URL, overrides "+envServer+" and config")
+	token := fs.String("token", "", "access token, overrides "+envToken+" and config")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("can't load config: %w", err)
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if *token != "" {
+		cfg.Token = *token
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd := &command{
+		c:   client.New(cfg.Server, cfg.Token),
+		ctx: ctx,
+	}
+
+	name, rest := fs.Arg(0), fs.Args()[1:]
+	switch name {
+	case "ls":
+		return cmd.ls(rest)
+	case "stat":
+		return cmd.stat(rest)
+	case "mkdir":
+		return withPath(rest, func(p string) error { return cmd.c.Mkdir(ctx, p) })
+	case "rm":
+		return withPath(rest, func(p string) error { return cmd.c.Delete(ctx, p) })
+	case "mv":
+		return cmd.transfer("mv", rest, cmd.c.Move)
+	case "cp":
+		return cmd.transfer("cp", rest, cmd.c.Copy)
+	case "put":
+		return cmd.put(rest)
+	case "get":
+		return cmd.get(rest)
+	case "sync":
+		return cmd.sync(rest)
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+func withPath(args []string, fn func(p string) error) error {
+	if len(args) != 1 {
+		return errors.New("expected one path")
+	}
+	return fn(args[0])
+}
+
+func withPaths(args []string, fn func(src, dest string) error) error {
+	if len(args) != 2 {
+		return errors.New("expected source and destination")
+	}
+	return fn(args[0], args[1])
+}
+
+// recursiveFlag registers -r flag of transfer commands
+func recursiveFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("r", false, "transfer directories recursively")
+}
+
+// conflictFlag registers -on-conflict flag of commands writing remote files
+func conflictFlag(fs *flag.FlagSet) *string {
+	return fs.String("on-conflict", string(client.ConflictFail), "existing file handling: fail, overwrite, rename or skip")
+}
+
+// parseTransfer parses flags of transfer command and returns its source and destination
+func parseTransfer(fs *flag.FlagSet, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 2 {
+		return nil, errors.New("expected source and destination")
+	}
+
+	return fs.Args(), nil
+}
+
+// transfer runs mv or cp of remote file src into directory dest
+func (cmd *command) transfer(name string, args []string,
+	fn func(ctx context.Context, dest string, src string, onConflict client.Conflict) (*client.Placement, error)) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	onConflict := conflictFlag(fs)
+	args, err := parseTransfer(fs, args)
+	if err != nil {
+		return err
+	}
+	src, dest := args[0], args[1]
+
+	placement, err := fn(cmd.ctx, dest, src, client.Conflict(*onConflict))
+	if err != nil {
+		return err
+	}
+
+	reportPlacement(path.Join("/", dest, path.Base(src)), placement)
+	return nil
+}
+
+// reportPlacement prints where the file was written when it isn't target
+func reportPlacement(target string, placement *client.Placement) {
+	switch {
+	case placement.Skipped:
+		fmt.Printf("skipped: %s already exists\n", placement.Path)
+	case placement.Path != target:
+		fmt.Printf("%s saved as %s\n", target, placement.Path)
+	}
+}
+
+func (cmd *command) ls(args []string) error {
+	dir := "/"
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	entries, err := cmd.c.List(cmd.ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range entries {
+		name, size := v.Name, formatSize(v.Size)
+		if v.IsDir() {
+			name, size = v.Name+"/", "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", size, v.ModTime.Local().Format("2006-01-02 15:04"), name)
+	}
+
+	return w.Flush()
+}
+
+func (cmd *command) stat(args []string) error {
+	return withPath(args, func(p string) error {
+		e, err := cmd.c.Stat(cmd.ctx, p)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Path: %s\nType: %s\nSize: %d\nModified: %s\n", e.Path, e.Type, e.Size, e.ModTime.Local())
+		return nil
+	})
+}
+
+// remoteTarget returns p/name when p is an existing remote directory and p otherwise
+func (cmd *command) remoteTarget(p string, name string) (string, error) {
+	e, err := cmd.c.Stat(cmd.ctx, p)
+	if errors.Is(err, client.ErrNotFound) {
+		return path.Clean("/" + p), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if e.IsDir() {
+		return path.Join(e.Path, name), nil
+	}
+	return e.Path, nil
+}
+
+// ensureRemoteDir creates remote directory unless it exists
+func (cmd *command) ensureRemoteDir(p string) error {
+	e, err := cmd.c.Stat(cmd.ctx, p)
+	if errors.Is(err, client.ErrNotFound) {
+		return cmd.c.Mkdir(cmd.ctx, p)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !e.IsDir() {
+		return fmt.Errorf("not directory: %s", p)
+	}
+	return nil
+}
+
+func (cmd *command) put(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	recursive := recursiveFlag(fs)
+	onConflict := conflictFlag(fs)
+	args, err := parseTransfer(fs, args)
+	if err != nil {
+		return err
+	}
+	local := filepath.Clean(args[0])
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+
+	target, err := cmd.remoteTarget(args[1], filepath.Base(local))
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return cmd.upload(local, target, info.Size(), client.Conflict(*onConflict))
+	}
+	if !*recursive {
+		return fmt.Errorf("%s is a directory, use -r", local)
+	}
+
+	return filepath.WalkDir(local, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(target, filepath.ToSlash(rel))
+
+		if d.IsDir() {
+			return cmd.ensureRemoteDir(remote)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return cmd.upload(p, remote, info.Size(), client.Conflict(*onConflict))
+	})
+}
+
+func (cmd *command) upload(local string, remote string, size int64, onConflict client.Conflict) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := newProgress(remote, size)
+	placement, err := cmd.c.Upload(cmd.ctx, remote, &progressReader{Reader: file, p: p}, onConflict)
+	p.finish()
+	if err != nil {
+		return err
+	}
+
+	reportPlacement(remote, placement)
+	return nil
+}
+
+func (cmd *command) get(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	recursive := recursiveFlag(fs)
+	args, err := parseTransfer(fs, args)
+	if err != nil {
+		return err
+	}
+
+	e, err := cmd.c.Stat(cmd.ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	local := filepath.Clean(args[1])
+	if info, err := os.Stat(local); err == nil && info.IsDir() && e.Path != "/" {
+		local = filepath.Join(local, path.Base(e.Path))
+	}
+
+	if !e.IsDir() {
+		return cmd.download(e, local)
+	}
+	if !*recursive {
+		return fmt.Errorf("%s is a directory, use -r", e.Path)
+	}
+
+	return cmd.downloadDir(e.Path, local)
+}
+
+func (cmd *command) downloadDir(remote string, local string) error {
+	err := os.MkdirAll(local, 0777)
+	if err != nil {
+		return err
+	}
+
+	entries, err := cmd.c.List(cmd.ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range entries {
+		target := filepath.Join(local, v.Name)
+		if v.IsDir() {
+			err = cmd.downloadDir(v.Path, target)
+		} else {
+			err = cmd.download(&v, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cmd *command) download(e *client.DirEntry, local string) error {
+	file, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+
+	p := newProgress(e.Path, e.Size)
+	err = cmd.c.Download(cmd.ctx, e.Path, &progressWriter{Writer: file, p: p})
+	p.finish()
+
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(local)
+	}
+
+	return err
+}
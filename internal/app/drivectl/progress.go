@@ -0,0 +1,108 @@
+package drivectl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	barWidth        = 30
+	progressRefresh = 100 * time.Millisecond
+)
+
+// progress draws transfer progress bar on stderr when it is a terminal
+type progress struct {
+	name    string
+	total   int64
+	done    int64
+	enabled bool
+	drawn   time.Time
+}
+
+func newProgress(name string, total int64) *progress {
+	info, err := os.Stderr.Stat()
+
+	return &progress{
+		name:    name,
+		total:   total,
+		enabled: err == nil && info.Mode()&os.ModeCharDevice != 0,
+	}
+}
+
+func (p *progress) add(n int) {
+	p.done += int64(n)
+	if time.Since(p.drawn) >= progressRefresh {
+		p.draw()
+	}
+}
+
+func (p *progress) draw() {
+	if !p.enabled {
+		return
+	}
+	p.drawn = time.Now()
+
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = min(float64(p.done)/float64(p.total), 1)
+	}
+	filled := int(ratio * barWidth)
+
+	name := p.name
+	if len(name) > 30 {
+		name = "..." + name[len(name)-27:]
+	}
+
+	fmt.Fprintf(os.Stderr, "\r%-30s [%s%s] %3d%% %s/%s", name,
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		int(ratio*100), formatSize(p.done), formatSize(p.total))
+}
+
+// finish draws the final state and moves to the next line
+func (p *progress) finish() {
+	if !p.enabled {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(os.Stderr)
+}
+
+type progressReader struct {
+	io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.p.add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	io.Writer
+	p *progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.p.add(n)
+	return n, err
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,533 @@
+package drivectl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/koan6gi/go-drive/pkg/client"
+)
+
+// Sync directions
+const (
+	syncUp   = "up"
+	syncDown = "down"
+	syncBoth = "both"
+)
+
+// syncEntry is a state of the file after the last successful sync, sides may differ
+// after a conflict which could only be resolved in one direction
+type syncEntry struct {
+	Hash           string    `json:"hash"`
+	LocalSize      int64     `json:"localSize"`
+	LocalModTime   time.Time `json:"localModTime"`
+	RemoteSize     int64     `json:"remoteSize"`
+	RemoteModTime  time.Time `json:"remoteModTime"`
+	RemoteChecksum string    `json:"remoteChecksum,omitempty"`
+}
+
+type syncState struct {
+	Server string                `json:"server"`
+	Local  string                `json:"local"`
+	Remote string                `json:"remote"`
+	Files  map[string]*syncEntry `json:"files"`
+}
+
+// localFile is a file found in the local directory
+type localFile struct {
+	full    string
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+type syncer struct {
+	cmd       *command
+	local     string
+	remote    string
+	direction string
+	dryRun    bool
+	state     *syncState
+	locals    map[string]*localFile
+	remotes   map[string]*client.DirEntry
+}
+
+func (cmd *command) sync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	direction := fs.String("direction", syncBoth, "sync direction: up, down or both")
+	dryRun := fs.Bool("dry-run", false, "print planned actions without executing them")
+	statePath := fs.String("state", "", "state file, defaults to a file in the user cache directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("expected local directory and remote directory")
+	}
+	if *direction != syncUp && *direction != syncDown && *direction != syncBoth {
+		return fmt.Errorf("bad direction: %s", *direction)
+	}
+
+	local, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	remote := path.Clean("/" + fs.Arg(1))
+
+	if *statePath == "" {
+		*statePath, err = defaultStatePath(cmd.c.BaseURL, local, remote)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := &syncer{
+		cmd:       cmd,
+		local:     local,
+		remote:    remote,
+		direction: *direction,
+		dryRun:    *dryRun,
+	}
+
+	s.state, err = loadState(*statePath)
+	if err != nil {
+		return err
+	}
+	s.state.Server, s.state.Local, s.state.Remote = cmd.c.BaseURL, local, remote
+
+	err = s.run()
+	if !s.dryRun {
+		if serr := saveState(*statePath, s.state); err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
+
+func defaultStatePath(server string, local string, remote string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(server + "\n" + local + "\n" + remote))
+	return filepath.Join(dir, "drivectl", "sync-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadState(p string) (*syncState, error) {
+	state := &syncState{Files: make(map[string]*syncEntry)}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if state.Files == nil {
+		state.Files = make(map[string]*syncEntry)
+	}
+
+	return state, err
+}
+
+func saveState(p string, state *syncState) error {
+	err := os.MkdirAll(filepath.Dir(p), 0777)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+func hashFile(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// scanLocal collects local files, hashes are reused from the state for files with unchanged size and mtime
+func (s *syncer) scanLocal() error {
+	s.locals = make(map[string]*localFile)
+
+	err := os.MkdirAll(s.local, 0777)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(s.local, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.local, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		f := &localFile{full: p, size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := s.state.Files[rel]; ok && prev.LocalSize == f.size && prev.LocalModTime.Equal(f.modTime) {
+			f.hash = prev.Hash
+		} else if f.hash, err = hashFile(p); err != nil {
+			return err
+		}
+
+		s.locals[rel] = f
+		return nil
+	})
+}
+
+// scanRemote collects remote files recursively
+func (s *syncer) scanRemote() error {
+	s.remotes = make(map[string]*client.DirEntry)
+
+	err := s.cmd.ensureRemoteDir(s.remote)
+	if err != nil {
+		return err
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := s.cmd.c.List(s.cmd.ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range entries {
+			if v.IsDir() {
+				if err := walk(v.Path); err != nil {
+					return err
+				}
+				continue
+			}
+
+			entry := v
+			s.remotes[strings.TrimPrefix(strings.TrimPrefix(v.Path, s.remote), "/")] = &entry
+		}
+		return nil
+	}
+
+	return walk(s.remote)
+}
+
+func (s *syncer) run() error {
+	err := s.scanLocal()
+	if err != nil {
+		return err
+	}
+
+	err = s.scanRemote()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for name := range s.locals {
+		names[name] = true
+	}
+	for name := range s.remotes {
+		names[name] = true
+	}
+	for name := range s.state.Files {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		if err := s.syncFile(name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *syncer) up() bool   { return s.direction != syncDown }
+func (s *syncer) down() bool { return s.direction != syncUp }
+
+// syncFile compares local and remote file with the last synced state and propagates changes
+func (s *syncer) syncFile(name string) error {
+	local, remote, prev := s.locals[name], s.remotes[name], s.state.Files[name]
+
+	localChanged := local != nil && (prev == nil || local.hash != prev.Hash)
+	remoteChanged := remote != nil && (prev == nil || prev.remoteChanged(remote))
+	localDeleted := local == nil && prev != nil
+	remoteDeleted := remote == nil && prev != nil
+
+	switch {
+	case local == nil && remote == nil:
+		return s.act("forget", name, func() error {
+			delete(s.state.Files, name)
+			return nil
+		})
+	case local != nil && remote != nil && prev == nil:
+		return s.syncNew(name, local, remote)
+	case localChanged && remoteChanged:
+		return s.conflict(name, local, remote)
+	case localChanged:
+		if s.up() {
+			return s.act("upload", name, func() error { return s.upload(name, local, remote != nil) })
+		}
+	case remoteChanged:
+		if s.down() {
+			return s.act("download", name, func() error { return s.download(name, s.localPath(name), remote) })
+		}
+	case localDeleted && remote != nil:
+		if s.up() {
+			return s.act("delete remote", name, func() error {
+				delete(s.state.Files, name)
+				return s.cmd.c.Delete(s.cmd.ctx, remote.Path)
+			})
+		}
+	case remoteDeleted && local != nil:
+		if s.down() {
+			return s.act("delete local", name, func() error {
+				delete(s.state.Files, name)
+				return os.Remove(local.full)
+			})
+		}
+	}
+
+	return nil
+}
+
+// remoteChanged compares the remote file with the synced state by checksum when the server reports it,
+// otherwise by size and modification time
+func (e *syncEntry) remoteChanged(remote *client.DirEntry) bool {
+	if remote.Checksum != "" && e.RemoteChecksum != "" {
+		return remote.Checksum != e.RemoteChecksum
+	}
+
+	return remote.Size != e.RemoteSize || !remote.ModTime.Equal(e.RemoteModTime)
+}
+
+// syncNew handles file which appeared on both sides since the last sync
+func (s *syncer) syncNew(name string, local *localFile, remote *client.DirEntry) error {
+	switch {
+	case local.size != remote.Size:
+		return s.conflict(name, local, remote)
+	case remote.Checksum != "":
+		if remote.Checksum != local.hash {
+			return s.conflict(name, local, remote)
+		}
+		s.record(name, local, remote)
+		return nil
+	}
+
+	// the server doesn't know the checksum yet, so the remote file is downloaded to compare
+	return s.act("compare", name, func() error {
+		hash, err := s.remoteHash(remote)
+		if err != nil {
+			return err
+		}
+
+		if hash != local.hash {
+			return s.conflict(name, local, remote)
+		}
+		s.record(name, local, remote)
+		return nil
+	})
+}
+
+func (s *syncer) remoteHash(remote *client.DirEntry) (string, error) {
+	h := sha256.New()
+	if err := s.cmd.c.Download(s.cmd.ctx, remote.Path, h); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// conflict keeps both versions, the remote one is saved under a conflict name
+func (s *syncer) conflict(name string, local *localFile, remote *client.DirEntry) error {
+	copyName := s.conflictName(name)
+
+	return s.act("conflict", name+" -> "+copyName, func() error {
+		// with one direction the other side can't be updated, both versions stay and are recorded
+		// as synced, so the same conflict isn't copied again on the next run
+		switch s.direction {
+		case syncUp:
+			// remote version stays, local one is uploaded next to it
+			if err := s.upload(copyName, local, false); err != nil {
+				return err
+			}
+			// the copy has no local file, it isn't tracked until it's synced down
+			delete(s.state.Files, copyName)
+			s.record(name, local, remote)
+			return nil
+		case syncDown:
+			// local version stays, remote one is downloaded next to it
+			if err := s.download(copyName, s.localPath(copyName), remote); err != nil {
+				return err
+			}
+			// the copy has no remote file, it isn't tracked until it's synced up
+			delete(s.state.Files, copyName)
+			s.record(name, local, remote)
+			return nil
+		}
+
+		err := s.download(copyName, s.localPath(copyName), remote)
+		if err != nil {
+			return err
+		}
+
+		copyFile := s.locals[copyName]
+		if err := s.upload(copyName, copyFile, false); err != nil {
+			return err
+		}
+
+		return s.upload(name, local, true)
+	})
+}
+
+// conflictName returns a name for the conflict copy which isn't used on either side
+func (s *syncer) conflictName(name string) string {
+	ext := path.Ext(name)
+	suffix := " (conflict " + time.Now().Format("2006-01-02 150405")
+
+	for i := 1; ; i++ {
+		copyName := strings.TrimSuffix(name, ext) + suffix + ")" + ext
+		if s.locals[copyName] == nil && s.remotes[copyName] == nil && s.state.Files[copyName] == nil {
+			return copyName
+		}
+		suffix = fmt.Sprintf(" (conflict %s %d", time.Now().Format("2006-01-02 150405"), i+1)
+	}
+}
+
+func (s *syncer) localPath(name string) string {
+	return filepath.Join(s.local, filepath.FromSlash(name))
+}
+
+func (s *syncer) remotePath(name string) string {
+	return path.Join(s.remote, name)
+}
+
+// act prints the action and executes it unless it is a dry run
+func (s *syncer) act(action string, name string, fn func() error) error {
+	fmt.Printf("%s %s\n", action, name)
+	if s.dryRun {
+		return nil
+	}
+
+	return fn()
+}
+
+func (s *syncer) upload(name string, local *localFile, exists bool) error {
+	target := s.remotePath(name)
+
+	err := s.cmd.ensureRemoteDir(path.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(local.full)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p := newProgress(target, local.size)
+	r := &progressReader{Reader: file, p: p}
+	if exists {
+		err = s.cmd.c.Update(s.cmd.ctx, target, r)
+	} else {
+		_, err = s.cmd.c.Upload(s.cmd.ctx, target, r, client.ConflictFail)
+	}
+	p.finish()
+	if err != nil {
+		return err
+	}
+
+	remote, err := s.cmd.c.Stat(s.cmd.ctx, target)
+	if err != nil {
+		return err
+	}
+
+	s.record(name, local, remote)
+	return nil
+}
+
+func (s *syncer) download(name string, target string, remote *client.DirEntry) error {
+	err := os.MkdirAll(filepath.Dir(target), 0777)
+	if err != nil {
+		return err
+	}
+
+	err = s.cmd.download(remote, target)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashFile(target)
+	if err != nil {
+		return err
+	}
+
+	local := &localFile{full: target, size: info.Size(), modTime: info.ModTime(), hash: hash}
+	s.locals[name] = local
+	s.record(name, local, remote)
+
+	return nil
+}
+
+func (s *syncer) record(name string, local *localFile, remote *client.DirEntry) {
+	s.state.Files[name] = &syncEntry{
+		Hash:           local.hash,
+		LocalSize:      local.size,
+		LocalModTime:   local.modTime,
+		RemoteSize:     remote.Size,
+		RemoteModTime:  remote.ModTime,
+		RemoteChecksum: remote.Checksum,
+	}
+}
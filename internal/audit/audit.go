@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+)
+
+// Outcomes of audited operations
+const (
+	OutcomeSuccess  = "success"
+	OutcomeAccepted = "accepted"
+	OutcomeDenied   = "denied"
+	OutcomeFailure  = "failure"
+)
+
+// Record describes a single operation performed by a user
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Remote    string    `json:"remote,omitempty"`
+	Operation string    `json:"operation"`
+	Path      string    `json:"path,omitempty"`
+	Dest      string    `json:"dest,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Filter selects records, zero fields match everything
+type Filter struct {
+	User   string
+	Prefix string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+func (f *Filter) match(r *Record) bool {
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.Prefix != "" && !fspath.HasPrefix(r.Path, f.Prefix) && (r.Dest == "" || !fspath.HasPrefix(r.Dest, f.Prefix)) {
+		return false
+	}
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Log is an append-only file of JSON records, one per line
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	name string
+}
+
+var AuditLog *Log
+
+func Open(name string) (*Log, error) {
+	err := os.MkdirAll(filepath.Dir(name), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{
+		mu:   sync.Mutex{},
+		file: file,
+		name: name,
+	}, nil
+}
+
+// Write appends record to the log, nil log discards records
+func (l *Log) Write(r Record) error {
+	if l == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query returns records matching filter, newest first.
+// Writers are not blocked, a partially written last line is skipped
+func (l *Log) Query(f Filter) ([]Record, error) {
+	file, err := os.Open(l.name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make([]Record, 0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) != nil || !f.match(&r) {
+			continue
+		}
+
+		result = append(result, r)
+		if f.Limit > 0 && len(result) > f.Limit {
+			result = result[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
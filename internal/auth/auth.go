@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+)
+
+// Tokens maps bearer tokens to user names, authentication is disabled when empty
+var Tokens map[string]string
+
+// Permissions maps user names to directories they can access, users without entry can access everything
+var Permissions map[string][]string
+
+// Admins contains users allowed to use administrative endpoints
+var Admins map[string]bool
+
+type ctxKey struct{}
+
+// ParseTokens parses "token=user" pairs separated by commas
+func ParseTokens(s string) (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		token, user, ok := strings.Cut(v, "=")
+		if !ok || token == "" || user == "" {
+			return nil, fmt.Errorf("bad token definition: %s", v)
+		}
+		tokens[token] = user
+	}
+
+	return tokens, nil
+}
+
+// ParsePermissions parses "user=/dir1;/dir2" definitions separated by commas
+func ParsePermissions(s string) (map[string][]string, error) {
+	permissions := make(map[string][]string)
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		user, dirs, ok := strings.Cut(v, "=")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("bad permission definition: %s", v)
+		}
+
+		for _, dir := range strings.Split(dirs, ";") {
+			if !strings.HasPrefix(dir, "/") {
+				return nil, fmt.Errorf("bad permission directory: %s", dir)
+			}
+			permissions[user] = append(permissions[user], dir)
+		}
+	}
+
+	return permissions, nil
+}
+
+// CanAccess reports whether user can access path
+func CanAccess(user string, path string) bool {
+	dirs, ok := Permissions[user]
+	if !ok {
+		return true
+	}
+
+	for _, v := range dirs {
+		if fspath.HasPrefix(path, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccessAny reports whether user can access at least one of non-empty paths
+func CanAccessAny(user string, paths ...string) bool {
+	for _, v := range paths {
+		if v != "" && CanAccess(user, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsAdmin reports whether user can use administrative endpoints,
+// anonymous user is an administrator when authentication is disabled
+func IsAdmin(user string) bool {
+	if user == "" {
+		return len(Tokens) == 0
+	}
+
+	return Admins[user]
+}
+
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// UserFromContext returns name of the authenticated user, empty for anonymous requests
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(ctxKey{}).(string)
+	return user
+}
+
+// Middleware authenticates requests by verified client certificate or bearer token
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := certificateUser(r); user != "" {
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+			return
+		}
+
+		if len(Tokens) == 0 || public(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && eventStream(r.URL.Path) {
+			// browsers can't set headers for EventSource and WebSocket connections
+			token = r.URL.Query().Get("access_token")
+			ok = token != ""
+		}
+		user, known := Tokens[token]
+		if !ok || !known {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, fmt.Sprintf("%s: bad token", http.StatusText(http.StatusUnauthorized)), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// public reports whether path is served without authentication
+func public(path string) bool {
+	return strings.HasPrefix(path, "/swagger/") || path == "/healthz" || path == "/readyz"
+}
+
+// eventStream reports whether path is an event stream which accepts token in the query string
+func eventStream(path string) bool {
+	return path == "/events" || path == "/events/ws"
+}
+
+// certificateUser returns common name of the verified TLS client certificate
+func certificateUser(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,602 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+)
+
+// BackendFS stores files in a local directory
+const BackendFS = "fs"
+
+// Name policies of the storage tree
+const (
+	NamingSensitive   = "sensitive"
+	NamingInsensitive = "insensitive"
+	NamingPreserving  = "preserving"
+)
+
+// Compression encodings
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const redacted = "<redacted>"
+
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	TLS      TLSConfig      `yaml:"tls" toml:"tls"`
+	Storage  StorageConfig  `yaml:"storage" toml:"storage"`
+	Auth     AuthConfig     `yaml:"auth" toml:"auth"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Webhooks WebhooksConfig `yaml:"webhooks" toml:"webhooks"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" toml:"idleTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+}
+
+// Client certificate modes
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLSConfig enables HTTPS when both certificate and key are set,
+// the files are reloaded when they change on disk
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile" toml:"certFile"`
+	KeyFile      string `yaml:"keyFile" toml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile" toml:"clientCAFile"`
+	ClientAuth   string `yaml:"clientAuth" toml:"clientAuth"`
+	RedirectAddr string `yaml:"redirectAddr" toml:"redirectAddr"`
+}
+
+type StorageConfig struct {
+	Backend          string        `yaml:"backend" toml:"backend"`
+	Root             string        `yaml:"root" toml:"root"`
+	DataDir          string        `yaml:"dataDir" toml:"dataDir"`
+	Naming           string        `yaml:"naming" toml:"naming"`
+	Compression      string        `yaml:"compression" toml:"compression"`
+	MaxFileSize      int64         `yaml:"maxFileSize" toml:"maxFileSize"`
+	MinFreeSpace     int64         `yaml:"minFreeSpace" toml:"minFreeSpace"`
+	RescanInterval   time.Duration `yaml:"rescanInterval" toml:"rescanInterval"`
+	ThumbnailWorkers int           `yaml:"thumbnailWorkers" toml:"thumbnailWorkers"`
+	ScrubInterval    time.Duration `yaml:"scrubInterval" toml:"scrubInterval"`
+}
+
+// AuthConfig disables authentication when no tokens are configured
+type AuthConfig struct {
+	Tokens      []Token             `yaml:"tokens" toml:"tokens"`
+	Permissions map[string][]string `yaml:"permissions" toml:"permissions"`
+	Admins      []string            `yaml:"admins" toml:"admins"`
+}
+
+// Trace exporters
+const (
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingOTLP   = "otlp"
+)
+
+// TracingConfig configures export of OpenTelemetry spans, endpoint is an OTLP/HTTP URL
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	ServiceName string  `yaml:"serviceName" toml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio"`
+}
+
+// WebhooksConfig lists internal networks webhooks may target, e.g. "10.0.0.0/8",
+// loopback, link-local and private addresses are refused otherwise
+type WebhooksConfig struct {
+	AllowedNetworks []string `yaml:"allowedNetworks" toml:"allowedNetworks"`
+}
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogConfig configures server log, audit log defaults to audit.log in the data directory
+type LogConfig struct {
+	Level     string `yaml:"level" toml:"level"`
+	Format    string `yaml:"format" toml:"format"`
+	AuditFile string `yaml:"auditFile" toml:"auditFile"`
+}
+
+type Token struct {
+	Token string `yaml:"token" toml:"token"`
+	User  string `yaml:"user" toml:"user"`
+}
+
+// setting is an option which can be set from environment variable or flag
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"addr", "GO_DRIVE_ADDR", "listen address", func(c *Config, v string) error {
+		c.Server.Addr = v
+		return nil
+	}},
+	{"read-header-timeout", "GO_DRIVE_READ_HEADER_TIMEOUT", "maximum duration for reading request headers", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadHeaderTimeout, v)
+	}},
+	{"read-timeout", "GO_DRIVE_READ_TIMEOUT", "maximum duration for reading request", func(c *Config, v string) error {
+		return setDuration(&c.Server.ReadTimeout, v)
+	}},
+	{"write-timeout", "GO_DRIVE_WRITE_TIMEOUT", "maximum duration for writing response", func(c *Config, v string) error {
+		return setDuration(&c.Server.WriteTimeout, v)
+	}},
+	{"idle-timeout", "GO_DRIVE_IDLE_TIMEOUT", "maximum duration of idle keep-alive connection", func(c *Config, v string) error {
+		return setDuration(&c.Server.IdleTimeout, v)
+	}},
+	{"shutdown-timeout", "GO_DRIVE_SHUTDOWN_TIMEOUT", "maximum duration of draining active requests on shutdown", func(c *Config, v string) error {
+		return setDuration(&c.Server.ShutdownTimeout, v)
+	}},
+	{"tls-cert", "GO_DRIVE_TLS_CERT", "TLS certificate file", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "GO_DRIVE_TLS_KEY", "TLS private key file", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"tls-client-ca", "GO_DRIVE_TLS_CLIENT_CA", "CA bundle for verifying client certificates", func(c *Config, v string) error {
+		c.TLS.ClientCAFile = v
+		return nil
+	}},
+	{"tls-client-auth", "GO_DRIVE_TLS_CLIENT_AUTH", "client certificate mode: none, optional or require", func(c *Config, v string) error {
+		c.TLS.ClientAuth = v
+		return nil
+	}},
+	{"tls-redirect-addr", "GO_DRIVE_TLS_REDIRECT_ADDR", "plain HTTP address redirecting to HTTPS", func(c *Config, v string) error {
+		c.TLS.RedirectAddr = v
+		return nil
+	}},
+	{"backend", "GO_DRIVE_BACKEND", "storage backend", func(c *Config, v string) error {
+		c.Storage.Backend = v
+		return nil
+	}},
+	{"storage-root", "GO_DRIVE_STORAGE_ROOT", "directory with stored files", func(c *Config, v string) error {
+		c.Storage.Root = v
+		return nil
+	}},
+	{"data-dir", "GO_DRIVE_DATA_DIR", "directory with metadata and service state", func(c *Config, v string) error {
+		c.Storage.DataDir = v
+		return nil
+	}},
+	{"naming", "GO_DRIVE_NAMING", "name comparison: sensitive, insensitive or preserving case", func(c *Config, v string) error {
+		c.Storage.Naming = v
+		return nil
+	}},
+	{"compression", "GO_DRIVE_COMPRESSION", "compression of stored text files: none, gzip or zstd", func(c *Config, v string) error {
+		c.Storage.Compression = v
+		return nil
+	}},
+	{"max-file-size", "GO_DRIVE_MAX_FILE_SIZE", "maximum size of uploaded file in bytes", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad size: %s", v)
+		}
+		c.Storage.MaxFileSize = n
+		return nil
+	}},
+	{"min-free-space", "GO_DRIVE_MIN_FREE_SPACE", "free space in bytes required for readiness, 0 disables the check", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad size: %s", v)
+		}
+		c.Storage.MinFreeSpace = n
+		return nil
+	}},
+	{"rescan-interval", "GO_DRIVE_RESCAN_INTERVAL", "interval of full storage rescan", func(c *Config, v string) error {
+		return setDuration(&c.Storage.RescanInterval, v)
+	}},
+	{"thumbnail-workers", "GO_DRIVE_THUMBNAIL_WORKERS", "number of workers pregenerating thumbnails of new images, 0 disables pregeneration", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("bad number: %s", v)
+		}
+		c.Storage.ThumbnailWorkers = n
+		return nil
+	}},
+	{"scrub-interval", "GO_DRIVE_SCRUB_INTERVAL", "interval of stored files integrity check, 0 disables the check", func(c *Config, v string) error {
+		return setDuration(&c.Storage.ScrubInterval, v)
+	}},
+	{"tokens", "GO_DRIVE_TOKENS", `bearer tokens as "token=user" pairs separated by commas`, func(c *Config, v string) error {
+		tokens, err := auth.ParseTokens(v)
+		if err != nil {
+			return err
+		}
+
+		c.Auth.Tokens = nil
+		for token, user := range tokens {
+			c.Auth.Tokens = append(c.Auth.Tokens, Token{Token: token, User: user})
+		}
+		sort.Slice(c.Auth.Tokens, func(i, j int) bool { return c.Auth.Tokens[i].User < c.Auth.Tokens[j].User })
+		return nil
+	}},
+	{"permissions", "GO_DRIVE_PERMISSIONS", `user directories as "user=/dir1;/dir2" separated by commas`, func(c *Config, v string) error {
+		permissions, err := auth.ParsePermissions(v)
+		if err != nil {
+			return err
+		}
+		c.Auth.Permissions = permissions
+		return nil
+	}},
+	{"admins", "GO_DRIVE_ADMINS", "administrator user names separated by commas", func(c *Config, v string) error {
+		c.Auth.Admins = nil
+		for _, user := range strings.Split(v, ",") {
+			if user = strings.TrimSpace(user); user != "" {
+				c.Auth.Admins = append(c.Auth.Admins, user)
+			}
+		}
+		return nil
+	}},
+	{"log-level", "GO_DRIVE_LOG_LEVEL", "log level: debug, info, warn or error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "GO_DRIVE_LOG_FORMAT", "log format: json or text", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"tracing-exporter", "GO_DRIVE_TRACING_EXPORTER", "trace exporter: none, stdout or otlp", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+		return nil
+	}},
+	{"tracing-endpoint", "GO_DRIVE_TRACING_ENDPOINT", "OTLP/HTTP traces endpoint URL", func(c *Config, v string) error {
+		c.Tracing.Endpoint = v
+		return nil
+	}},
+	{"tracing-sample-ratio", "GO_DRIVE_TRACING_SAMPLE_RATIO", "fraction of traces started by the server which are sampled", func(c *Config, v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("bad ratio: %s", v)
+		}
+		c.Tracing.SampleRatio = n
+		return nil
+	}},
+	{"audit-file", "GO_DRIVE_AUDIT_FILE", "audit log file", func(c *Config, v string) error {
+		c.Log.AuditFile = v
+		return nil
+	}},
+	{"webhook-allowed-networks", "GO_DRIVE_WEBHOOK_ALLOWED_NETWORKS", "internal networks webhooks may target as CIDRs separated by commas", func(c *Config, v string) error {
+		c.Webhooks.AllowedNetworks = nil
+		for _, network := range strings.Split(v, ",") {
+			if network = strings.TrimSpace(network); network != "" {
+				c.Webhooks.AllowedNetworks = append(c.Webhooks.AllowedNetworks, network)
+			}
+		}
+		return nil
+	}},
+}
+
+func setDuration(d *time.Duration, v string) error {
+	n, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("bad duration: %s", v)
+	}
+	*d = n
+	return nil
+}
+
+// Default returns configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       15 * time.Minute,
+			WriteTimeout:      15 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		TLS: TLSConfig{
+			ClientAuth: ClientAuthNone,
+		},
+		Storage: StorageConfig{
+			Backend:          BackendFS,
+			Root:             "./storage",
+			DataDir:          "./data",
+			Naming:           NamingSensitive,
+			Compression:      CompressionNone,
+			MaxFileSize:      100 << 20,
+			MinFreeSpace:     100 << 20,
+			RescanInterval:   5 * time.Minute,
+			ThumbnailWorkers: 1,
+			ScrubInterval:    24 * time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingNone,
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "go-drive",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds configuration from defaults, config file, environment and command line flags,
+// later sources override earlier ones. Config file is taken from -config flag or GO_DRIVE_CONFIG.
+// Returns flag.ErrHelp when usage was requested.
+func Load(name string, args []string) (cfg *Config, printConfig bool, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("GO_DRIVE_CONFIG"), "config file in YAML or TOML format (env GO_DRIVE_CONFIG)")
+	fs.BoolVar(&printConfig, "print-config", false, "print effective configuration and exit")
+	for _, s := range settings {
+		fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, false, err
+	}
+	if fs.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	cfg = Default()
+	if *configFile != "" {
+		err = cfg.loadFile(*configFile)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(cfg, v); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if serr := s.set(cfg, f.Value.String()); serr != nil {
+					err = fmt.Errorf("-%s: %w", s.flag, serr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return cfg, printConfig, cfg.Validate()
+}
+
+func (c *Config) loadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), c)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown key %s", meta.Undecoded()[0])
+		}
+	default:
+		return fmt.Errorf("%s: unknown config format, expected .yaml, .yml or .toml", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Validate checks that configuration is complete and consistent
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if c.Server.Addr == "" {
+		fail("server.addr: must not be empty")
+	}
+	if c.Server.ReadHeaderTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		fail("server: timeouts must not be negative")
+	}
+
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdownTimeout: must be positive")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls: certFile and keyFile must be set together")
+	}
+	switch c.TLS.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if c.TLS.ClientCAFile == "" {
+			fail("tls.clientAuth: %s requires clientCAFile", c.TLS.ClientAuth)
+		}
+	default:
+		fail("tls.clientAuth: unknown mode %q", c.TLS.ClientAuth)
+	}
+	if c.TLS.CertFile == "" && (c.TLS.ClientCAFile != "" || c.TLS.RedirectAddr != "") {
+		fail("tls: clientCAFile and redirectAddr require certFile and keyFile")
+	}
+	if c.TLS.RedirectAddr != "" && c.TLS.RedirectAddr == c.Server.Addr {
+		fail("tls.redirectAddr: must differ from server.addr")
+	}
+
+	if c.Storage.Backend != BackendFS {
+		fail("storage.backend: unsupported backend %q", c.Storage.Backend)
+	}
+	if c.Storage.Root == "" {
+		fail("storage.root: must not be empty")
+	}
+	if c.Storage.DataDir == "" {
+		fail("storage.dataDir: must not be empty")
+	}
+	if c.Storage.Root != "" && c.Storage.DataDir != "" && filepath.Clean(c.Storage.Root) == filepath.Clean(c.Storage.DataDir) {
+		fail("storage: root and dataDir must be different directories")
+	}
+	switch c.Storage.Naming {
+	case NamingSensitive, NamingInsensitive, NamingPreserving:
+	default:
+		fail("storage.naming: unknown policy %q", c.Storage.Naming)
+	}
+	switch c.Storage.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		fail("storage.compression: unknown encoding %q", c.Storage.Compression)
+	}
+	if c.Storage.MaxFileSize <= 0 {
+		fail("storage.maxFileSize: must be positive")
+	}
+	if c.Storage.MinFreeSpace < 0 {
+		fail("storage.minFreeSpace: must not be negative")
+	}
+	if c.Storage.RescanInterval <= 0 {
+		fail("storage.rescanInterval: must be positive")
+	}
+	if c.Storage.ThumbnailWorkers < 0 {
+		fail("storage.thumbnailWorkers: must not be negative")
+	}
+	if c.Storage.ScrubInterval < 0 {
+		fail("storage.scrubInterval: must not be negative")
+	}
+
+	seen := make(map[string]bool)
+	for i, v := range c.Auth.Tokens {
+		if v.Token == "" || v.User == "" {
+			fail("auth.tokens[%d]: token and user must not be empty", i)
+		}
+		if seen[v.Token] {
+			fail("auth.tokens[%d]: duplicate token", i)
+		}
+		seen[v.Token] = true
+	}
+	for user, dirs := range c.Auth.Permissions {
+		for _, dir := range dirs {
+			if !strings.HasPrefix(dir, "/") {
+				fail("auth.permissions.%s: directory %q must be absolute", user, dir)
+			}
+		}
+	}
+
+	for i, v := range c.Auth.Admins {
+		if v == "" {
+			fail("auth.admins[%d]: must not be empty", i)
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level: unknown level %q", c.Log.Level)
+	}
+	if c.Log.Format != LogFormatJSON && c.Log.Format != LogFormatText {
+		fail("log.format: unknown format %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.Tracing.Endpoint == "" {
+			fail("tracing.endpoint: must not be empty for otlp exporter")
+		}
+	default:
+		fail("tracing.exporter: unknown exporter %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.ServiceName == "" {
+		fail("tracing.serviceName: must not be empty")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sampleRatio: must be between 0 and 1")
+	}
+
+	for i, v := range c.Webhooks.AllowedNetworks {
+		if _, err := netip.ParsePrefix(v); err != nil {
+			fail("webhooks.allowedNetworks[%d]: bad network %q", i, v)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TokenMap returns tokens in the form used by auth.Tokens
+func (c *Config) TokenMap() map[string]string {
+	tokens := make(map[string]string, len(c.Auth.Tokens))
+	for _, v := range c.Auth.Tokens {
+		tokens[v.Token] = v.User
+	}
+	return tokens
+}
+
+// WebhookNetworks returns parsed allowed networks of webhooks, invalid ones are rejected by Validate
+func (c *Config) WebhookNetworks() []netip.Prefix {
+	networks := make([]netip.Prefix, 0, len(c.Webhooks.AllowedNetworks))
+	for _, v := range c.Webhooks.AllowedNetworks {
+		if prefix, err := netip.ParsePrefix(v); err == nil {
+			networks = append(networks, prefix.Masked())
+		}
+	}
+	return networks
+}
+
+// Print writes configuration as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	out := *c
+	out.Auth.Tokens = make([]Token, len(c.Auth.Tokens))
+	for i, v := range c.Auth.Tokens {
+		out.Auth.Tokens[i] = Token{Token: redacted, User: v.User}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&out); err != nil {
+		return err
+	}
+	return enc.Close()
+}
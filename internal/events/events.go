@@ -0,0 +1,174 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+)
+
+// Number of recent events kept for subscribers resuming after reconnect
+const historySize = 1024
+
+// Event types
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+	Moved   = "moved"
+	Copied  = "copied"
+	// Reset is a marker without ID published when changes were lost, subscribers have to relist the tree
+	Reset = "reset"
+)
+
+// Event describes a change of a storage item
+type Event struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	ItemType string    `json:"itemType"`
+	Path     string    `json:"path"`
+	OldPath  string    `json:"oldPath,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Size     int64     `json:"size"`
+	External bool      `json:"external,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type Bus struct {
+	mu      sync.Mutex
+	seq     uint64
+	next    int
+	subs    map[int]func(Event)
+	history []Event
+	// changes after lostAfter were lost when lost is set
+	lost      bool
+	lostAfter uint64
+}
+
+var EventBus *Bus
+
+func NewBus() *Bus {
+	return &Bus{
+		mu:   sync.Mutex{},
+		subs: make(map[int]func(Event)),
+	}
+}
+
+// Subscribe registers fn to be called for every published event, fn must not block,
+// returned function removes the subscription
+func (b *Bus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(fn)
+}
+
+// SubscribeFrom is like Subscribe but also returns events published after lastID,
+// ok is false when some of them are no longer kept
+func (b *Bus) SubscribeFrom(lastID uint64, fn func(Event)) (missed []Event, unsubscribe func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ok = lastID >= b.seq || (len(b.history) > 0 && b.history[0].ID <= lastID+1)
+	if b.lost && lastID <= b.lostAfter {
+		ok = false
+	}
+
+	for _, v := range b.history {
+		if v.ID > lastID {
+			missed = append(missed, v)
+		}
+	}
+
+	return missed, b.subscribe(fn), ok
+}
+
+// LastID returns ID of the last published event
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq
+}
+
+// subscribe registers fn, caller must hold mu
+func (b *Bus) subscribe(fn func(Event)) func() {
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// Matches reports whether path or old path of the event is inside prefix directory
+func (e Event) Matches(prefix string) bool {
+	return fspath.HasPrefix(e.Path, prefix) || (e.OldPath != "" && fspath.HasPrefix(e.OldPath, prefix))
+}
+
+// SetLastID continues event numbering after id
+func (b *Bus) SetLastID(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq = id
+}
+
+// SetLostAfter refuses resuming from id and earlier IDs, changes after id were lost
+func (b *Bus) SetLostAfter(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lost, b.lostAfter = true, id
+}
+
+// Publish delivers the event to subscribers, events without ID get the next one,
+// nil bus drops events
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.ID == 0 {
+		b.seq++
+		e.ID = b.seq
+	} else if e.ID > b.seq {
+		b.seq = e.ID
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for _, fn := range b.subs {
+		fn(e)
+	}
+}
+
+// Reset tells subscribers that changes after the last published event were lost, resuming
+// from an earlier ID is refused afterwards. The marker isn't kept in history, nil bus ignores it
+func (b *Bus) Reset() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lost, b.lostAfter = true, b.seq
+
+	e := Event{Type: Reset, Time: time.Now()}
+	for _, fn := range b.subs {
+		fn(e)
+	}
+}
@@ -0,0 +1,170 @@
+package fspath
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Limits of storage paths in bytes
+const (
+	MaxNameLength = 255
+	MaxPathLength = 4096
+)
+
+// Reasons of rejected paths
+var (
+	ErrInvalidUTF8  = errors.New("invalid UTF-8")
+	ErrNotAbsolute  = errors.New("path must start with /")
+	ErrEmptySegment = errors.New("empty path segment")
+	ErrDotSegment   = errors.New(`"." and ".." segments are not allowed`)
+	ErrBackslash    = errors.New("backslash is not allowed")
+	ErrControlChar  = errors.New("control characters are not allowed")
+	ErrNameTooLong  = fmt.Errorf("name is longer than %d bytes", MaxNameLength)
+	ErrPathTooLong  = fmt.Errorf("path is longer than %d bytes", MaxPathLength)
+	ErrReservedName = errors.New("reserved name")
+)
+
+// Error describes rejected path or name
+type Error struct {
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("bad path %q: %v", e.Path, e.Err) }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Path is a clean absolute slash-separated storage path in NFC, the root is "/".
+// Untrusted input must be converted with Parse, conversion of a string is for paths
+// which are known to be clean, like ones built from the storage tree
+type Path string
+
+const Root Path = "/"
+
+// Parse normalizes s to NFC and validates it, a single trailing slash is dropped
+func Parse(s string) (Path, error) {
+	if !utf8.ValidString(s) {
+		return "", &Error{Path: s, Err: ErrInvalidUTF8}
+	}
+
+	p := norm.NFC.String(s)
+	if !strings.HasPrefix(p, "/") {
+		return "", &Error{Path: s, Err: ErrNotAbsolute}
+	}
+	if len(p) > MaxPathLength {
+		return "", &Error{Path: s, Err: ErrPathTooLong}
+	}
+	if p == "/" {
+		return Root, nil
+	}
+
+	p = strings.TrimSuffix(p, "/")
+	for _, v := range strings.Split(p[1:], "/") {
+		if err := checkSegment(v); err != nil {
+			return "", &Error{Path: s, Err: err}
+		}
+	}
+
+	return Path(p), nil
+}
+
+// Name normalizes name of a new file or directory to NFC and validates it,
+// unlike Parse it also rejects names reserved on common platforms
+func Name(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", &Error{Path: name, Err: ErrInvalidUTF8}
+	}
+
+	n := norm.NFC.String(name)
+	if strings.Contains(n, "/") {
+		return "", &Error{Path: name, Err: errors.New("name must not contain /")}
+	}
+	if err := checkSegment(n); err != nil {
+		return "", &Error{Path: name, Err: err}
+	}
+	if reserved(n) {
+		return "", &Error{Path: name, Err: ErrReservedName}
+	}
+
+	return n, nil
+}
+
+func checkSegment(s string) error {
+	switch {
+	case s == "":
+		return ErrEmptySegment
+	case s == "." || s == "..":
+		return ErrDotSegment
+	case len(s) > MaxNameLength:
+		return ErrNameTooLong
+	case strings.ContainsRune(s, '\\'):
+		return ErrBackslash
+	case strings.IndexFunc(s, unicode.IsControl) >= 0:
+		return ErrControlChar
+	}
+
+	return nil
+}
+
+// Device names which can't be used as file names on Windows, with or without extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func reserved(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	return reservedNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+func (p Path) String() string {
+	return string(p)
+}
+
+func (p Path) IsRoot() bool {
+	return p == Root || p == ""
+}
+
+// Base returns the last segment, empty for the root
+func (p Path) Base() string {
+	return string(p[strings.LastIndexByte(string(p), '/')+1:])
+}
+
+// Dir returns the parent directory, the root is its own parent
+func (p Path) Dir() Path {
+	i := strings.LastIndexByte(string(p), '/')
+	if i <= 0 {
+		return Root
+	}
+	return p[:i]
+}
+
+// Segments returns names from the root to the last segment, empty for the root
+func (p Path) Segments() []string {
+	if p.IsRoot() {
+		return nil
+	}
+	return strings.Split(string(p[1:]), "/")
+}
+
+// Join appends name which must be a single valid segment
+func (p Path) Join(name string) Path {
+	if p.IsRoot() {
+		return Path("/" + name)
+	}
+	return Path(string(p) + "/" + name)
+}
+
+// HasPrefix reports whether path equals prefix directory or is nested in it
+func HasPrefix(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
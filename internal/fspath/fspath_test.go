@@ -0,0 +1,232 @@
+package fspath
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// "é" as a single code point and as "e" followed by a combining acute accent
+const (
+	nfc = "\u00e9"
+	nfd = "e\u0301"
+)
+
+func TestParse(t *testing.T) {
+	longName := strings.Repeat("a", MaxNameLength)
+	// segments of MaxNameLength bytes with slashes, exactly MaxPathLength bytes long
+	longPath := strings.Repeat("/"+longName, MaxPathLength/(MaxNameLength+1))
+
+	tests := []struct {
+		name string
+		in   string
+		want Path
+		err  error
+	}{
+		{name: "root", in: "/", want: Root},
+		{name: "file", in: "/a", want: "/a"},
+		{name: "nested", in: "/a/b/c.txt", want: "/a/b/c.txt"},
+		{name: "trailing slash", in: "/a/b/", want: "/a/b"},
+		{name: "spaces", in: "/my docs/a b.txt", want: "/my docs/a b.txt"},
+		{name: "dots inside name", in: "/a..b/.hidden/...", want: "/a..b/.hidden/..."},
+		{name: "reserved name", in: "/CON/nul.txt", want: "/CON/nul.txt"},
+		{name: "nfc", in: "/caf" + nfc, want: "/caf" + nfc},
+		{name: "nfd", in: "/caf" + nfd + "/x", want: "/caf" + nfc + "/x"},
+		{name: "max name", in: "/" + longName, want: Path("/" + longName)},
+		{name: "max path", in: longPath, want: Path(longPath)},
+
+		{name: "empty", in: "", err: ErrNotAbsolute},
+		{name: "relative", in: "a/b", err: ErrNotAbsolute},
+		{name: "dot relative", in: "./a", err: ErrNotAbsolute},
+		{name: "invalid utf8", in: "/a\xffb", err: ErrInvalidUTF8},
+		{name: "double slash", in: "//a", err: ErrEmptySegment},
+		{name: "inner empty segment", in: "/a//b", err: ErrEmptySegment},
+		{name: "two trailing slashes", in: "/a//", err: ErrEmptySegment},
+		{name: "dot", in: "/a/./b", err: ErrDotSegment},
+		{name: "trailing dot", in: "/a/.", err: ErrDotSegment},
+		{name: "dot dot", in: "/a/../b", err: ErrDotSegment},
+		{name: "leading dot dot", in: "/..", err: ErrDotSegment},
+		{name: "trailing dot dot", in: "/a/../", err: ErrDotSegment},
+		{name: "backslash", in: `/a\b`, err: ErrBackslash},
+		{name: "backslash traversal", in: `/a\..\b`, err: ErrBackslash},
+		{name: "nul", in: "/a\x00b", err: ErrControlChar},
+		{name: "newline", in: "/a\nb", err: ErrControlChar},
+		{name: "tab", in: "/a\tb", err: ErrControlChar},
+		{name: "delete", in: "/a\x7fb", err: ErrControlChar},
+		{name: "c1 control", in: "/a\u0085b", err: ErrControlChar},
+		{name: "name too long", in: "/" + longName + "a", err: ErrNameTooLong},
+		{name: "path too long", in: longPath + "b", err: ErrPathTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.err != nil {
+				checkError(t, tt.in, err, tt.err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Parse(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	longName := strings.Repeat("a", MaxNameLength)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{name: "plain", in: "a.txt", want: "a.txt"},
+		{name: "hidden", in: ".env", want: ".env"},
+		{name: "nfc", in: "caf" + nfc, want: "caf" + nfc},
+		{name: "nfd", in: "caf" + nfd, want: "caf" + nfc},
+		{name: "max length", in: longName, want: longName},
+		// the limit is in bytes of the normalized name
+		{name: "max length multibyte", in: strings.Repeat(nfd, MaxNameLength/2), want: strings.Repeat(nfc, MaxNameLength/2)},
+		{name: "reserved prefix", in: "CONSOLE", want: "CONSOLE"},
+		{name: "reserved suffix", in: "MYCON", want: "MYCON"},
+		{name: "com10", in: "COM10", want: "COM10"},
+
+		{name: "empty", in: "", err: ErrEmptySegment},
+		{name: "dot", in: ".", err: ErrDotSegment},
+		{name: "dot dot", in: "..", err: ErrDotSegment},
+		{name: "slash", in: "a/b"},
+		{name: "only slash", in: "/"},
+		{name: "backslash", in: `a\b`, err: ErrBackslash},
+		{name: "nul", in: "a\x00", err: ErrControlChar},
+		{name: "carriage return", in: "a\rb", err: ErrControlChar},
+		{name: "invalid utf8", in: "\xc3", err: ErrInvalidUTF8},
+		{name: "too long", in: longName + "a", err: ErrNameTooLong},
+		{name: "too long multibyte", in: strings.Repeat(nfc, MaxNameLength/2+1), err: ErrNameTooLong},
+		{name: "reserved", in: "CON", err: ErrReservedName},
+		{name: "reserved lower case", in: "nul", err: ErrReservedName},
+		{name: "reserved mixed case", in: "Aux", err: ErrReservedName},
+		{name: "reserved with extension", in: "prn.txt", err: ErrReservedName},
+		{name: "reserved with extensions", in: "com1.tar.gz", err: ErrReservedName},
+		{name: "reserved trailing space", in: "LPT9 .txt", err: ErrReservedName},
+		{name: "reserved com0", in: "COM0", err: ErrReservedName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Name(tt.in)
+			if tt.want == "" {
+				checkError(t, tt.in, err, tt.err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Name(%q) error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Name(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// checkError checks that err is an *Error of the input wrapping target, nil target accepts any reason
+func checkError(t *testing.T, in string, err error, target error) {
+	t.Helper()
+
+	var pathErr *Error
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("%q: got error %v, want *Error", in, err)
+	}
+	if pathErr.Path != in {
+		t.Fatalf("%q: error path is %q", in, pathErr.Path)
+	}
+	if target != nil && !errors.Is(err, target) {
+		t.Fatalf("%q: got error %v, want %v", in, err, target)
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{path: "/a", prefix: "/", want: true},
+		{path: "/", prefix: "/", want: true},
+		{path: "/a/b", prefix: "", want: true},
+		{path: "/a", prefix: "/a", want: true},
+		{path: "/a", prefix: "/a/", want: true},
+		{path: "/a/b", prefix: "/a", want: true},
+		{path: "/a/b/c", prefix: "/a", want: true},
+		{path: "/a/b/c", prefix: "/a/b/", want: true},
+		{path: "/ab", prefix: "/a", want: false},
+		{path: "/a.txt", prefix: "/a", want: false},
+		{path: "/a", prefix: "/a/b", want: false},
+		{path: "/b/a", prefix: "/a", want: false},
+		{path: "/", prefix: "/a", want: false},
+		{path: "/caf" + nfc + "/x", prefix: "/caf" + nfc, want: true},
+		// paths are compared as is, callers normalize them with Parse
+		{path: "/caf" + nfc + "/x", prefix: "/caf" + nfd, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := HasPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("HasPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		path Path
+		name string
+		want Path
+	}{
+		{path: Root, name: "a", want: "/a"},
+		{path: "", name: "a", want: "/a"},
+		{path: "/a", name: "b", want: "/a/b"},
+		{path: "/a/b", name: "c.txt", want: "/a/b/c.txt"},
+		{path: "/caf" + nfc, name: nfc, want: "/caf" + nfc + "/" + nfc},
+	}
+
+	for _, tt := range tests {
+		got := tt.path.Join(tt.name)
+		if got != tt.want {
+			t.Errorf("%q.Join(%q) = %q, want %q", tt.path, tt.name, got, tt.want)
+		}
+		if _, err := Parse(string(got)); err != nil {
+			t.Errorf("%q.Join(%q) is not a valid path: %v", tt.path, tt.name, err)
+		}
+		if got.Base() != tt.name || got.Dir() != Path("/"+strings.TrimPrefix(string(tt.path), "/")) {
+			t.Errorf("%q.Join(%q) = %q has base %q and dir %q", tt.path, tt.name, got, got.Base(), got.Dir())
+		}
+	}
+}
+
+func TestPathParts(t *testing.T) {
+	tests := []struct {
+		path     Path
+		base     string
+		dir      Path
+		segments []string
+	}{
+		{path: Root, base: "", dir: Root, segments: nil},
+		{path: "/a", base: "a", dir: Root, segments: []string{"a"}},
+		{path: "/a/b/c", base: "c", dir: "/a/b", segments: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.path.Base(); got != tt.base {
+			t.Errorf("%q.Base() = %q, want %q", tt.path, got, tt.base)
+		}
+		if got := tt.path.Dir(); got != tt.dir {
+			t.Errorf("%q.Dir() = %q, want %q", tt.path, got, tt.dir)
+		}
+		if got := tt.path.Segments(); strings.Join(got, "/") != strings.Join(tt.segments, "/") || len(got) != len(tt.segments) {
+			t.Errorf("%q.Segments() = %q, want %q", tt.path, got, tt.segments)
+		}
+	}
+}
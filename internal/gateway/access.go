@@ -0,0 +1,29 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/fspath"
+)
+
+// authorize checks that all paths are valid and accessible by the caller, writes 400 or 403 otherwise
+func authorize(w http.ResponseWriter, r *http.Request, paths ...string) bool {
+	user := auth.UserFromContext(r.Context())
+
+	for _, v := range paths {
+		p, err := fspath.Parse(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+			return false
+		}
+
+		if !auth.CanAccess(user, p.String()) {
+			http.Error(w, fmt.Sprintf("%s: access denied: %s", http.StatusText(http.StatusForbidden), v), http.StatusForbidden)
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/audit"
+	"github.com/koan6gi/go-drive/internal/auth"
+)
+
+const defaultAuditLimit = 1000
+
+// audited records operation to the audit log with outcome derived from response status
+func audited(operation string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		info := infoFromContext(r.Context())
+		if !info.audited {
+			query := r.URL.Query()
+			info.auditPath, info.auditDest = query.Get("path"), query.Get("dest")
+			if info.auditPath == "" {
+				info.auditPath = query.Get("src")
+			}
+		}
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		record := audit.Record{
+			Time:      time.Now(),
+			RequestID: info.id,
+			User:      info.user,
+			Remote:    r.RemoteAddr,
+			Operation: operation,
+			Path:      info.auditPath,
+			Dest:      info.auditDest,
+			Status:    sw.status,
+			Outcome:   outcome(sw.status),
+		}
+		if sw.status >= http.StatusBadRequest {
+			record.Error = strings.TrimSpace(string(sw.errText))
+		}
+
+		if err := audit.AuditLog.Write(record); err != nil {
+			slog.Error("can't write audit record", slog.String("requestId", info.id), slog.String("error", err.Error()))
+		}
+	})
+}
+
+func outcome(status int) string {
+	switch {
+	case status == http.StatusAccepted:
+		return audit.OutcomeAccepted
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return audit.OutcomeFailure
+	default:
+		return audit.OutcomeSuccess
+	}
+}
+
+// Audit godoc
+// @Summary Query audit log
+// @Description Get audited operations, newest first, available to administrators only
+// @Tags Admin
+// @Produce json
+// @Param user query string false "User name"
+// @Param prefix query string false "Path prefix"
+// @Param from query string false "Start time, RFC 3339"
+// @Param to query string false "End time, RFC 3339, exclusive"
+// @Param limit query integer false "Maximum number of records, default 1000"
+// @Success 200 {array} audit.Record "Audit records"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /audit [get]
+func Audit(w http.ResponseWriter, r *http.Request) {
+	if !auth.IsAdmin(auth.UserFromContext(r.Context())) {
+		http.Error(w, fmt.Sprintf("%s: administrator access required", http.StatusText(http.StatusForbidden)), http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		User:   query.Get("user"),
+		Prefix: query.Get("prefix"),
+		Limit:  defaultAuditLimit,
+	}
+
+	var err error
+	for _, v := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if s := query.Get(v.name); s != "" {
+			*v.t, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: bad %s time", http.StatusText(http.StatusBadRequest), v.name), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if s := query.Get("limit"); s != "" {
+		filter.Limit, err = strconv.Atoi(s)
+		if err != nil || filter.Limit <= 0 {
+			http.Error(w, fmt.Sprintf("%s: bad limit", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := audit.AuditLog.Query(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
@@ -0,0 +1,276 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/audit"
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/repository"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Batch limits
+const (
+	maxBatchOperations = 1000
+	maxBatchBody       = 1 << 20
+)
+
+// Batch operations
+const (
+	batchDelete = "delete"
+	batchMove   = "move"
+	batchCopy   = "copy"
+	batchMkdir  = "mkdir"
+)
+
+// BatchOperation is a single operation of a batch, delete and mkdir use path, move and copy use src and dest
+type BatchOperation struct {
+	Op         string `json:"op" enums:"delete,move,copy,mkdir"`
+	Path       string `json:"path,omitempty"`
+	Src        string `json:"src,omitempty"`
+	Dest       string `json:"dest,omitempty"`
+	OnConflict string `json:"onConflict,omitempty" enums:"fail,overwrite,rename,skip"`
+}
+
+// BatchRequest is a body of batch request, transactional batch is rolled back on the first failure
+type BatchRequest struct {
+	Operations    []BatchOperation `json:"operations"`
+	Transactional bool             `json:"transactional,omitempty"`
+}
+
+// BatchResult is an outcome of a single operation, status is an HTTP status code of the same request
+// made separately, 424 means the operation wasn't executed or was rolled back
+type BatchResult struct {
+	Op      string `json:"op"`
+	Status  int    `json:"status"`
+	Path    string `json:"path,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchResponse contains results in order of operations
+type BatchResponse struct {
+	Results    []BatchResult `json:"results"`
+	RolledBack bool          `json:"rolledBack,omitempty"`
+}
+
+// Batch godoc
+// @Summary Batch operations
+// @Description Execute delete, move, copy and mkdir operations in order under a single storage lock.
+// @Description Failed operations don't stop the batch unless it is transactional, then all changes are rolled back.
+// @Description Overwriting files is not supported in transactional batches.
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param batch body BatchRequest true "Operations"
+// @Success 200 {object} BatchResponse "Results of operations"
+// @Failure 400 {object} BatchResponse "Transactional batch failed"
+// @Failure 403 {object} BatchResponse "Transactional batch failed"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {object} BatchResponse "Transactional batch failed"
+// @Router /batch [post]
+func Batch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, fmt.Sprintf("%s: body is larger than %d bytes", http.StatusText(http.StatusRequestEntityTooLarge), maxBatchBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("%s: incorrect body", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		http.Error(w, fmt.Sprintf("%s: no operations", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("%s: more than %d operations", http.StatusText(http.StatusRequestEntityTooLarge), maxBatchOperations), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := BatchResponse{
+		Results: make([]BatchResult, len(req.Operations)),
+	}
+
+	// everything is checked before the lock is taken, invalid operations fail a transactional batch early
+	failed := -1
+	for i, v := range req.Operations {
+		resp.Results[i] = checkBatchOperation(r, v)
+		if resp.Results[i].Status != 0 && failed < 0 {
+			failed = i
+		}
+	}
+	if req.Transactional && failed >= 0 {
+		abortBatch(&resp, failed, -1)
+		finishBatch(w, r, req, &resp, resp.Results[failed].Status)
+		return
+	}
+
+	ctx := r.Context()
+	var tx *repository.Transaction
+	if req.Transactional {
+		ctx, tx = repository.WithTransaction(ctx)
+	}
+
+	if !lockRequest(w, r) {
+		return
+	}
+	defer repository.FileStorage.Unlock()
+
+	for i, v := range req.Operations {
+		if resp.Results[i].Status != 0 {
+			continue
+		}
+
+		resp.Results[i] = runBatchOperation(ctx, v)
+		if tx == nil || resp.Results[i].Status == http.StatusOK {
+			continue
+		}
+
+		if err := tx.Rollback(); err != nil {
+			slog.Error("can't roll back batch", slog.String("requestId", infoFromContext(ctx).id), slog.String("error", err.Error()))
+		}
+		abortBatch(&resp, i, i)
+		resp.RolledBack = true
+		finishBatch(w, r, req, &resp, resp.Results[i].Status)
+		return
+	}
+
+	if tx != nil {
+		tx.Commit()
+	}
+
+	finishBatch(w, r, req, &resp, http.StatusOK)
+}
+
+// checkBatchOperation validates operation and its access, zero status means the operation can run
+func checkBatchOperation(r *http.Request, op BatchOperation) BatchResult {
+	result := BatchResult{Op: op.Op}
+
+	var paths []string
+	switch op.Op {
+	case batchDelete, batchMkdir:
+		paths = []string{op.Path}
+	case batchMove, batchCopy:
+		paths = []string{op.Dest, op.Src}
+		if _, err := repository.ParseConflict(op.OnConflict); err != nil {
+			result.Status, result.Error = http.StatusBadRequest, err.Error()
+			return result
+		}
+	default:
+		result.Status, result.Error = http.StatusBadRequest, fmt.Sprintf("unknown operation %q", op.Op)
+		return result
+	}
+
+	user := auth.UserFromContext(r.Context())
+	for _, v := range paths {
+		p, err := fspath.Parse(v)
+		if err != nil {
+			result.Status, result.Error = http.StatusBadRequest, err.Error()
+			return result
+		}
+
+		if !auth.CanAccess(user, p.String()) {
+			result.Status, result.Error = http.StatusForbidden, fmt.Sprintf("access denied: %s", v)
+			return result
+		}
+	}
+
+	return result
+}
+
+func runBatchOperation(ctx context.Context, op BatchOperation) BatchResult {
+	result := BatchResult{Op: op.Op, Path: op.Path}
+
+	var err error
+	switch op.Op {
+	case batchDelete:
+		err = repository.FileStorage.Delete(ctx, op.Path)
+	case batchMkdir:
+		err = repository.FileStorage.CreateDirectory(ctx, op.Path)
+	case batchMove, batchCopy:
+		onConflict, _ := repository.ParseConflict(op.OnConflict)
+
+		var placement repository.Placement
+		if op.Op == batchMove {
+			placement, err = repository.FileStorage.Move(ctx, op.Dest, op.Src, onConflict)
+		} else {
+			placement, err = repository.FileStorage.Copy(ctx, op.Dest, op.Src, onConflict)
+		}
+		result.Path, result.Skipped = placement.Path, placement.Skipped
+	}
+
+	switch e := err.(type) {
+	case nil:
+		result.Status = http.StatusOK
+	case *repErr.PathError:
+		result.Status, result.Error = pathErrorStatus(e), e.Error()
+	default:
+		result.Status, result.Error = http.StatusInternalServerError, e.Error()
+	}
+
+	return result
+}
+
+// abortBatch marks all operations of a failed transactional batch except the failed one,
+// operations up to executed were rolled back
+func abortBatch(resp *BatchResponse, failed int, executed int) {
+	for i := range resp.Results {
+		if i == failed {
+			continue
+		}
+
+		resp.Results[i].Status = http.StatusFailedDependency
+		resp.Results[i].Path, resp.Results[i].Skipped = "", false
+		resp.Results[i].Error = "not executed"
+		if i < executed {
+			resp.Results[i].Error = "rolled back"
+		}
+	}
+}
+
+// finishBatch writes audit record for every operation and sends the response
+func finishBatch(w http.ResponseWriter, r *http.Request, req BatchRequest, resp *BatchResponse, status int) {
+	info := infoFromContext(r.Context())
+
+	for i, v := range req.Operations {
+		result := resp.Results[i]
+
+		operation := v.Op
+		if operation == batchMkdir {
+			operation = "create_directory"
+		}
+
+		record := audit.Record{
+			Time:      time.Now(),
+			RequestID: info.id,
+			User:      info.user,
+			Remote:    r.RemoteAddr,
+			Operation: "batch_" + operation,
+			Path:      v.Path,
+			Dest:      v.Dest,
+			Status:    result.Status,
+			Outcome:   outcome(result.Status),
+			Error:     result.Error,
+		}
+		if v.Src != "" {
+			record.Path = v.Src
+		}
+
+		if err := audit.AuditLog.Write(record); err != nil {
+			slog.Error("can't write audit record", slog.String("requestId", info.id), slog.String("error", err.Error()))
+		}
+	}
+
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/koan6gi/go-drive/internal/repository"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Change page sizes
+const (
+	defaultChangesLimit = 1000
+	maxChangesLimit     = 10000
+)
+
+// Changes godoc
+// @Summary List changes
+// @Description Get changes recorded after cursor in order. Without cursor returns the current cursor to start from.
+// @Description 410 with resetRequired means the cursor is too old and the client has to relist the tree.
+// @Tags Events
+// @Produce json
+// @Param cursor query string false "Cursor returned by previous call"
+// @Param prefix query string false "Directory to get changes of"
+// @Param limit query integer false "Maximum number of changes"
+// @Success 200 {object} repository.ChangeSet "Changes and the next cursor"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 410 {object} repository.ChangeSet "Reset required"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /changes [get]
+func Changes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	limit := defaultChangesLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxChangesLimit {
+			http.Error(w, fmt.Sprintf("%s: bad limit", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	set, err := repository.FileStorage.Changes(r.Context(), prefix, query.Get("cursor"), limit)
+	if err != nil {
+		switch e := err.(type) {
+		case *repErr.CursorError:
+			writeJSON(w, http.StatusGone, set)
+		case *repErr.PathError:
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
+		default:
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, set)
+}
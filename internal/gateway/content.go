@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Inline content is rendered in a unique origin without scripts, content which can load
+// resources by itself is also denied to load anything but inline images and styles
+const (
+	sandboxPolicy       = "sandbox"
+	strictSandboxPolicy = "sandbox; default-src 'none'; img-src data:; media-src data:; style-src 'unsafe-inline'"
+)
+
+// Types which browsers render as documents able to run scripts in addition to all XML types
+var activeContentTypes = map[string]bool{
+	"text/html":       true,
+	"application/pdf": true,
+}
+
+func activeContentType(mediaType string) bool {
+	return activeContentTypes[mediaType] || mediaType == "text/xml" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// setContentHeaders describes file content, inline content is shown by browsers instead of being saved
+func setContentHeaders(w http.ResponseWriter, name string, contentType string, inline bool) {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": name}); v != "" {
+		disposition = v
+	}
+
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if !inline {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if activeContentType(mediaType) {
+		w.Header().Set("Content-Security-Policy", strictSandboxPolicy)
+	} else {
+		w.Header().Set("Content-Security-Policy", sandboxPolicy)
+	}
+}
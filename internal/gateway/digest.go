@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/koan6gi/go-drive/internal/repository"
+)
+
+// Digest headers, Repr-Digest is RFC 9530 and Digest is its obsolete RFC 3230 predecessor.
+// Only SHA-256 is supported, digests of other algorithms are ignored
+const (
+	headerReprDigest = "Repr-Digest"
+	headerDigest     = "Digest"
+)
+
+// setDigestHeaders describes file content by its hex encoded SHA-256 checksum
+func setDigestHeaders(w http.ResponseWriter, checksum string) {
+	sum, err := hex.DecodeString(checksum)
+	if err != nil || len(sum) == 0 {
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(sum)
+	w.Header().Set(headerReprDigest, "sha-256=:"+encoded+":")
+	w.Header().Set(headerDigest, "sha-256="+encoded)
+}
+
+// requestedChecksum returns hex encoded SHA-256 of the content from request digest headers,
+// empty string means the client didn't send it
+func requestedChecksum(r *http.Request) (string, error) {
+	var found []string
+
+	for _, v := range r.Header.Values(headerReprDigest) {
+		for _, member := range strings.Split(v, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+			if strings.ToLower(key) != "sha-256" {
+				continue
+			}
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return "", fmt.Errorf("bad %s: sha-256 must be a byte sequence", headerReprDigest)
+			}
+			found = append(found, value[1:len(value)-1])
+		}
+	}
+
+	for _, v := range r.Header.Values(headerDigest) {
+		for _, member := range strings.Split(v, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+			if strings.ToLower(key) == "sha-256" {
+				found = append(found, value)
+			}
+		}
+	}
+
+	checksum := ""
+	for _, v := range found {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != 32 {
+			return "", fmt.Errorf("bad sha-256 digest %q", v)
+		}
+
+		if checksum != "" && checksum != hex.EncodeToString(sum) {
+			return "", fmt.Errorf("digest headers don't match")
+		}
+		checksum = hex.EncodeToString(sum)
+	}
+
+	return checksum, nil
+}
+
+// verifyChecksum compares uploaded content with the checksum sent by the client
+// and writes 400 when they differ, content is rewound for writing
+func verifyChecksum(w http.ResponseWriter, r *http.Request, content io.ReadSeeker) bool {
+	expected, err := requestedChecksum(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return false
+	}
+	if expected == "" {
+		return true
+	}
+
+	h := repository.NewHash()
+	_, err = io.Copy(h, content)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return false
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		http.Error(w, fmt.Sprintf("%s: checksum mismatch: expected %s, got %s", http.StatusText(http.StatusBadRequest), expected, actual), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,284 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/events"
+	"github.com/koan6gi/go-drive/internal/repository"
+)
+
+// Change feed settings
+const (
+	feedBuffer    = 256
+	feedHeartbeat = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{}
+
+// shutdown is closed when the server stops, long-lived streams end so that draining is not blocked
+var (
+	shutdown     = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+func stopStreams() {
+	shutdownOnce.Do(func() { close(shutdown) })
+}
+
+// feed is a subscription of a single client to change events
+type feed struct {
+	events   chan events.Event
+	overflow chan struct{}
+	once     sync.Once
+	missed   []events.Event
+	resumed  bool
+	sent     uint64
+	close    func()
+}
+
+// fresh reports whether the event was not sent yet, journal and bus may both contain it
+func (f *feed) fresh(e events.Event) bool {
+	if e.ID <= f.sent {
+		return false
+	}
+
+	f.sent = e.ID
+	return true
+}
+
+// subscribe subscribes the caller to events inside prefix visible to them
+func subscribe(r *http.Request, prefix string, lastID uint64, resume bool) *feed {
+	user := auth.UserFromContext(r.Context())
+	visible := func(e events.Event) bool {
+		return e.Matches(prefix) && auth.CanAccessAny(user, e.Path, e.OldPath)
+	}
+
+	f := &feed{
+		events:   make(chan events.Event, feedBuffer),
+		overflow: make(chan struct{}),
+		resumed:  true,
+	}
+
+	push := func(e events.Event) {
+		if e.Type != events.Reset && !visible(e) {
+			return
+		}
+		select {
+		case f.events <- e:
+		default:
+			// slow client reconnects with the last received ID
+			f.once.Do(func() { close(f.overflow) })
+		}
+	}
+
+	if !resume {
+		f.close = events.EventBus.Subscribe(push)
+		return f
+	}
+
+	missed, unsubscribe, ok := events.EventBus.SubscribeFrom(lastID, push)
+	f.close = unsubscribe
+	f.resumed = ok
+
+	if !ok {
+		// events older than the bus history are read from the change journal
+		set, err := repository.FileStorage.Changes(r.Context(), prefix, strconv.FormatUint(lastID, 10), feedBuffer)
+		if err == nil && !set.HasMore && !set.ResetRequired {
+			f.resumed = true
+			f.missed = set.Changes
+			lastID, _ = strconv.ParseUint(set.Cursor, 10, 64)
+		}
+	}
+
+	for _, v := range missed {
+		if v.ID > lastID && visible(v) {
+			f.missed = append(f.missed, v)
+		}
+	}
+
+	return f
+}
+
+// feedParams returns subscribed prefix and ID of the last event received by the client
+func feedParams(r *http.Request) (string, uint64, bool, error) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
+	}
+	if last == "" {
+		return prefix, 0, false, nil
+	}
+
+	lastID, err := strconv.ParseUint(last, 10, 64)
+	return prefix, lastID, true, err
+}
+
+// Events godoc
+// @Summary Change feed
+// @Description Stream change events inside prefix as Server-Sent Events, a "reset" event means some changes were lost
+// @Tags Events
+// @Produce text/event-stream
+// @Param prefix query string false "Directory to watch"
+// @Param lastEventId query integer false "Resume after this event ID, Last-Event-ID header is also accepted"
+// @Success 200 {object} events.Event "Event stream"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /events [get]
+func Events(w http.ResponseWriter, r *http.Request) {
+	prefix, lastID, resume, err := feedParams(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: bad last event id", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: streaming unsupported", http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+		return
+	}
+
+	// event stream outlives server read and write timeouts
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	f := subscribe(r, prefix, lastID, resume)
+	defer f.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !f.resumed {
+		writeReset(w)
+	}
+	for _, v := range f.missed {
+		if f.fresh(v) {
+			writeSSE(w, v)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shutdown:
+			return
+		case <-f.overflow:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e := <-f.events:
+			switch {
+			case e.Type == events.Reset:
+				writeReset(w)
+			case f.fresh(e):
+				writeSSE(w, e)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeReset tells the client that changes were lost and it has to relist
+func writeReset(w http.ResponseWriter) {
+	fmt.Fprintf(w, "event: %s\ndata: {}\n\n", events.Reset)
+}
+
+func writeSSE(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
+
+// EventsWebSocket godoc
+// @Summary Change feed over WebSocket
+// @Description Stream change events inside prefix as JSON WebSocket messages, a message of type "reset" means some changes were lost
+// @Tags Events
+// @Param prefix query string false "Directory to watch"
+// @Param lastEventId query integer false "Resume after this event ID"
+// @Success 101 {object} events.Event "Event stream"
+// @Failure 400 {string} string "Bad Request"
+// @Router /events/ws [get]
+func EventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	prefix, lastID, resume, err := feedParams(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: bad last event id", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	f := subscribe(r, prefix, lastID, resume)
+	defer f.close()
+
+	// reader detects closed connections, client messages are ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if !f.resumed {
+		if conn.WriteJSON(events.Event{Type: events.Reset}) != nil {
+			return
+		}
+	}
+	for _, v := range f.missed {
+		if f.fresh(v) && conn.WriteJSON(v) != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-shutdown:
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"), time.Now().Add(time.Second))
+			return
+		case <-f.overflow:
+			return
+		case <-heartbeat.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+		case e := <-f.events:
+			switch {
+			case e.Type == events.Reset:
+				err = conn.WriteJSON(events.Event{Type: events.Reset})
+			case f.fresh(e):
+				err = conn.WriteJSON(e)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -1,36 +1,76 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	"github.com/koan6gi/go-drive/internal/metrics"
 	"github.com/koan6gi/go-drive/internal/repository"
 	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+	"github.com/koan6gi/go-drive/internal/tracing"
 )
 
-const (
-	maxFileSize = 100 << 20
-)
+// MaxFileSize limits size of uploaded files, configured on startup
+var MaxFileSize int64 = 100 << 20
+
+// conflictPolicy reads onConflict query parameter and writes 400 when it's unknown
+func conflictPolicy(w http.ResponseWriter, r *http.Request) (repository.Conflict, bool) {
+	onConflict, err := repository.ParseConflict(r.URL.Query().Get("onConflict"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return "", false
+	}
+
+	return onConflict, true
+}
+
+// pathErrorStatus returns response code of a rejected path, missing items and conflicts with existing ones
+// are told apart from bad requests
+func pathErrorStatus(err *repErr.PathError) int {
+	switch {
+	case errors.Is(err, repErr.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repErr.ErrExist), errors.Is(err, repErr.ErrChanged):
+		return http.StatusConflict
+	}
+
+	return http.StatusBadRequest
+}
 
 // Upload godoc
 // @Summary Upload file
 // @Description Upload a file to the specified path
 // @Tags Files
 // @Accept multipart/form-data
-// @Produce plain
+// @Produce json
 // @Param file formData file true "File to upload"
 // @Param path query string true "Destination path"
-// @Success 200 {string} string "file upload success"
+// @Param onConflict query string false "Existing file handling: fail, overwrite, rename or skip" default(fail)
+// @Param Repr-Digest header string false "Expected SHA-256 of the file as sha-256=:base64:, Digest header is also accepted"
+// @Success 200 {object} repository.Placement "Final path of the file"
+// @Header 200 {string} Repr-Digest "SHA-256 of the stored file"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /upload [post]
 func Upload(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize+1024)
+	onConflict, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
 
-	err := r.ParseMultipartForm(maxFileSize)
+	r.Body = http.MaxBytesReader(w, r.Body, MaxFileSize+1024)
+
+	_, span := tracing.Start(r.Context(), "multipart.Parse")
+	err := tracing.End(span, r.ParseMultipartForm(MaxFileSize))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: incorrect form: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
 		return
@@ -39,59 +79,109 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	formFile, handler, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: can't get a file", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
 	}
 	defer formFile.Close()
 
-	filePath := r.URL.Query().Get("path") + "/" + handler.Filename
-	if strings.HasPrefix(filePath, "//") {
-		filePath = filePath[1:]
+	if !verifyChecksum(w, r, formFile) {
+		return
+	}
+
+	dir, err := fspath.Parse(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return
+	}
+	name, err := fspath.Name(handler.Filename)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return
 	}
+	filePath := dir.Join(name).String()
 
-	repository.FileStorage.Lock()
+	setAuditPaths(r, filePath, "")
+	if !authorize(w, r, filePath) {
+		return
+	}
+
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	newFile, err := repository.FileStorage.CreateFile(filePath)
+	newFile, placement, err := repository.FileStorage.CreateFile(r.Context(), filePath, onConflict)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
 		return
 	}
-	defer newFile.Close()
 
-	if _, err := io.Copy(newFile, formFile); err != nil {
+	setAuditPaths(r, placement.Path, "")
+	if placement.Skipped {
+		writeJSON(w, http.StatusOK, placement)
+		return
+	}
+	// overwritten file is replaced only by successful Close
+	defer newFile.Abort()
+
+	_, span = tracing.Start(r.Context(), "file.Write")
+	n, err := io.Copy(newFile, formFile)
+	tracing.End(span, err)
+	metrics.UploadedBytes.Add(float64(n))
+	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "file upload success")
+	err = newFile.Close()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if checksum, err := newFile.Checksum(); err == nil {
+		setDigestHeaders(w, checksum)
+	}
+	writeJSON(w, http.StatusOK, placement)
 }
 
 // Download godoc
 // @Summary Download file
-// @Description Download file from specified path
+// @Description Download file from specified path with detected content type.
+// @Description Inline content is shown by browsers, documents able to run scripts are sandboxed
 // @Tags Files
 // @Produce octet-stream
 // @Param path query string true "File path to download"
+// @Param inline query bool false "Show in browser instead of saving"
 // @Success 200 {file} binary "File content"
+// @Header 200 {string} Repr-Digest "SHA-256 of the whole file"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /download [get]
 func Download(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Query().Get("path")
+	if !authorize(w, r, filePath) {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	file, err := repository.FileStorage.GetFile(filePath)
+	file, err := repository.FileStorage.GetFile(r.Context(), filePath)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
@@ -102,13 +192,18 @@ func Download(w http.ResponseWriter, r *http.Request) {
 	fileInfo, err := file.Stat()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Content-Disposition", "attachment; filename="+fileInfo.Name())
-	w.Header().Set("Content-Type", "application/octet-stream")
+	setContentHeaders(w, fileInfo.Name(), file.ContentType(), r.URL.Query().Get("inline") == "true")
+	if checksum, err := file.Checksum(); err == nil {
+		setDigestHeaders(w, checksum)
+	}
 	w.Header().Set("Accept-Ranges", "bytes")
 
-	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+	sw := &statusWriter{ResponseWriter: w}
+	http.ServeContent(sw, r, fileInfo.Name(), fileInfo.ModTime(), file)
+	metrics.DownloadedBytes.Add(float64(sw.bytes))
 }
 
 // CreateDirectory godoc
@@ -119,19 +214,28 @@ func Download(w http.ResponseWriter, r *http.Request) {
 // @Param path query string true "Directory path to create"
 // @Success 200 {string} string "create directory success"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /directory [post]
 func CreateDirectory(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
+	if !authorize(w, r, path) {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	err := repository.FileStorage.CreateDirectory(path)
+	err := repository.FileStorage.CreateDirectory(r.Context(), path)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
@@ -150,19 +254,27 @@ func CreateDirectory(w http.ResponseWriter, r *http.Request) {
 // @Param path query string true "Path to delete"
 // @Success 200 {string} string "delete success"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /delete [delete]
 func Delete(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
+	if !authorize(w, r, path) {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	err := repository.FileStorage.Delete(path)
+	err := repository.FileStorage.Delete(r.Context(), path)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
@@ -181,19 +293,27 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 // @Param path query string true "Directory path to list"
 // @Success 200 {array} string "List of files/directories"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /list [get]
 func List(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
+	if !authorize(w, r, path) {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	list, err := repository.FileStorage.List(path)
+	list, err := repository.FileStorage.List(r.Context(), path)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
@@ -214,38 +334,102 @@ func List(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Stat godoc
+// @Summary Get file or directory information
+// @Description Get information about file or directory at specified path
+// @Tags Directories
+// @Produce json
+// @Param path query string true "File or directory path"
+// @Success 200 {object} repository.DirEntry "File or directory information"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /stat [get]
+func Stat(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if !authorize(w, r, path) {
+		return
+	}
+
+	if !lockRequest(w, r) {
+		return
+	}
+	defer repository.FileStorage.Unlock()
+
+	entry, err := repository.FileStorage.Stat(r.Context(), path)
+	if err != nil {
+		switch e := err.(type) {
+		case *repErr.PathError:
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
+		default:
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entry)
+}
+
 // Move godoc
 // @Summary Move file/directory
 // @Description Move file or directory from source to destination
 // @Tags Files
-// @Produce plain
+// @Produce json
 // @Param src query string true "Source path"
 // @Param dest query string true "Destination path"
-// @Success 200 {string} string "move success"
+// @Param onConflict query string false "Existing file handling: fail, overwrite, rename or skip" default(fail)
+// @Param async query bool false "Run as background job"
+// @Success 200 {object} repository.Placement "Final path of the file"
+// @Success 202 {object} jobs.Job "Started job"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /move [put]
 func Move(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	dest := query.Get("dest")
 	src := query.Get("src")
+	if !authorize(w, r, dest, src) {
+		return
+	}
+
+	onConflict, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if query.Get("async") == "true" {
+		job := jobs.JobManager.Start(r.Context(), "move", func(ctx context.Context) (string, error) {
+			placement, err := repository.FileStorage.Move(repository.Unlocked(ctx), dest, src, onConflict)
+			return placement.Path, err
+		})
+
+		writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	err := repository.FileStorage.Move(dest, src)
+	placement, err := repository.FileStorage.Move(r.Context(), dest, src, onConflict)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "move success")
+	writeJSON(w, http.StatusOK, placement)
 }
 
 // Update godoc
@@ -256,12 +440,24 @@ func Move(w http.ResponseWriter, r *http.Request) {
 // @Produce plain
 // @Param file formData file true "New file content"
 // @Param path query string true "File path to update"
+// @Param Repr-Digest header string false "Expected SHA-256 of the file as sha-256=:base64:, Digest header is also accepted"
 // @Success 200 {string} string "file update success"
+// @Header 200 {string} Repr-Digest "SHA-256 of the stored file"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /update [put]
 func Update(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(maxFileSize)
+	filePath := r.URL.Query().Get("path")
+	if !authorize(w, r, filePath) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxFileSize+1024)
+
+	_, span := tracing.Start(r.Context(), "multipart.Parse")
+	err := tracing.End(span, r.ParseMultipartForm(MaxFileSize))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: incorrect form", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
 		return
@@ -270,31 +466,51 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	formFile, _, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: can't get a file", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
 	}
 	defer formFile.Close()
 
-	filePath := r.URL.Query().Get("path")
+	if !verifyChecksum(w, r, formFile) {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	newFile, err := repository.FileStorage.GetFile(filePath)
+	newFile, err := repository.FileStorage.ReplaceFile(r.Context(), filePath)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
 		return
 	}
-	defer newFile.Close()
+	// the file is replaced only by successful Close
+	defer newFile.Abort()
+
+	_, span = tracing.Start(r.Context(), "file.Write")
+	n, err := io.Copy(newFile, formFile)
+	tracing.End(span, err)
+	metrics.UploadedBytes.Add(float64(n))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
 
-	if _, err := io.Copy(newFile, formFile); err != nil {
+	err = newFile.Close()
+	if err != nil {
 		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
 		return
 	}
 
+	if checksum, err := newFile.Checksum(); err == nil {
+		setDigestHeaders(w, checksum)
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "file update success")
 }
@@ -303,32 +519,58 @@ func Update(w http.ResponseWriter, r *http.Request) {
 // @Summary Copy file/directory
 // @Description Copy file or directory from source to destination
 // @Tags Files
-// @Produce plain
+// @Produce json
 // @Param src query string true "Source path"
 // @Param dest query string true "Destination path"
-// @Success 200 {string} string "copy success"
+// @Param onConflict query string false "Existing file handling: fail, overwrite, rename or skip" default(fail)
+// @Param async query bool false "Run as background job"
+// @Success 200 {object} repository.Placement "Final path of the file"
+// @Success 202 {object} jobs.Job "Started job"
 // @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /copy [put]
 func Copy(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	dest := query.Get("dest")
 	src := query.Get("src")
+	if !authorize(w, r, dest, src) {
+		return
+	}
+
+	onConflict, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
 
-	repository.FileStorage.Lock()
+	if query.Get("async") == "true" {
+		job := jobs.JobManager.Start(r.Context(), "copy", func(ctx context.Context) (string, error) {
+			placement, err := repository.FileStorage.Copy(repository.Unlocked(ctx), dest, src, onConflict)
+			return placement.Path, err
+		})
+
+		writeJSON(w, http.StatusAccepted, job)
+		return
+	}
+
+	if !lockRequest(w, r) {
+		return
+	}
 	defer repository.FileStorage.Unlock()
 
-	err := repository.FileStorage.Copy(dest, src)
+	placement, err := repository.FileStorage.Copy(r.Context(), dest, src, onConflict)
 	if err != nil {
 		switch e := err.(type) {
 		case *repErr.PathError:
-			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), e.Error()), http.StatusBadRequest)
+			code := pathErrorStatus(e)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), e.Error()), code)
 		default:
 			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), e.Error()), http.StatusInternalServerError)
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "copy success")
+	writeJSON(w, http.StatusOK, placement)
 }
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/repository"
+)
+
+// Readiness is the result of readiness checks
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Readiness statuses
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Healthz godoc
+// @Summary Liveness probe
+// @Description Report that the process is alive, no authentication required
+// @Tags Health
+// @Produce plain
+// @Success 200 {string} string "ok"
+// @Router /healthz [get]
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, statusOK)
+}
+
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Check that storage directory is writable, metadata is loaded, free space is above threshold and the server is not shutting down, no authentication required
+// @Tags Health
+// @Produce json
+// @Success 200 {object} Readiness "Ready"
+// @Failure 503 {object} Readiness "Not ready"
+// @Router /readyz [get]
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := Readiness{
+		Status: statusOK,
+		Checks: map[string]string{
+			"storage":  statusOK,
+			"shutdown": statusOK,
+		},
+	}
+
+	if err := repository.FileStorage.Ready(); err != nil {
+		readiness.Status = statusUnavailable
+		readiness.Checks["storage"] = err.Error()
+	}
+
+	select {
+	case <-shutdown:
+		readiness.Status = statusUnavailable
+		readiness.Checks["shutdown"] = "server is shutting down"
+	default:
+	}
+
+	status := http.StatusOK
+	if readiness.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, readiness)
+}
+
+// Diag godoc
+// @Summary Storage diagnostics
+// @Description Get tree size, lock contention, open file handles and backend status, available to administrators only
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} repository.Diagnostics "Diagnostics"
+// @Failure 403 {string} string "Forbidden"
+// @Router /diag [get]
+func Diag(w http.ResponseWriter, r *http.Request) {
+	if !auth.IsAdmin(auth.UserFromContext(r.Context())) {
+		http.Error(w, fmt.Sprintf("%s: administrator access required", http.StatusText(http.StatusForbidden)), http.StatusForbidden)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, repository.FileStorage.Diagnostics())
+}
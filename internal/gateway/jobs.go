@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	"github.com/koan6gi/go-drive/internal/repository"
+)
+
+// Extract godoc
+// @Summary Extract archive
+// @Description Start background extraction of zip, tar or tar.gz archive into destination directory
+// @Description Final paths of extracted files are listed in placements of the job
+// @Description Extraction isn't atomic, entries written before a failure stay in destination and are listed in placements
+// @Tags Files
+// @Produce json
+// @Param src query string true "Archive path"
+// @Param dest query string true "Destination directory"
+// @Param onConflict query string false "Existing file handling: fail, overwrite, rename or skip" default(fail)
+// @Success 202 {object} jobs.Job "Started job"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /extract [post]
+func Extract(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dest := query.Get("dest")
+	src := query.Get("src")
+	if !authorize(w, r, dest, src) {
+		return
+	}
+
+	onConflict, ok := conflictPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	job := jobs.JobManager.Start(r.Context(), "extract", func(ctx context.Context) (string, error) {
+		return dest, repository.FileStorage.Extract(repository.Unlocked(ctx), dest, src, onConflict)
+	})
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// Archive godoc
+// @Summary Create archive
+// @Description Start background packing of file or directory into zip archive
+// @Tags Files
+// @Produce json
+// @Param src query string true "File or directory path"
+// @Param dest query string true "Archive path"
+// @Success 202 {object} jobs.Job "Started job"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /archive [post]
+func Archive(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dest := query.Get("dest")
+	src := query.Get("src")
+	if !authorize(w, r, dest, src) {
+		return
+	}
+
+	job := jobs.JobManager.Start(r.Context(), "archive", func(ctx context.Context) (string, error) {
+		return dest, repository.FileStorage.Archive(repository.Unlocked(ctx), dest, src)
+	})
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// ListJobs godoc
+// @Summary List jobs
+// @Description Get states of background jobs started by the caller
+// @Tags Jobs
+// @Produce json
+// @Success 200 {array} jobs.Job "Jobs"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /jobs [get]
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jobs.JobManager.List(auth.UserFromContext(r.Context())))
+}
+
+// GetJob godoc
+// @Summary Get job
+// @Description Get state of background job
+// @Tags Jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} jobs.Job "Job state"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /jobs/{id} [get]
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobs.JobManager.Get(auth.UserFromContext(r.Context()), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: unknown job", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelJob godoc
+// @Summary Cancel job
+// @Description Request cancellation of running background job
+// @Tags Jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 202 {object} jobs.Job "Job state"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /jobs/{id} [delete]
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobs.JobManager.Cancel(auth.UserFromContext(r.Context()), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: unknown job", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
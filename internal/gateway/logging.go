@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+)
+
+// Incoming request IDs are accepted only if they look safe for logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestInfo is shared by middlewares and handlers of a single request
+type requestInfo struct {
+	id        string
+	user      string
+	auditPath string
+	auditDest string
+	audited   bool
+}
+
+type requestInfoKey struct{}
+
+func infoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if info == nil {
+		return &requestInfo{}
+	}
+	return info
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logRequests assigns request ID and writes access log entry after the request is served
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestInfo{id: r.Header.Get("X-Request-ID")}
+		if !requestIDPattern.MatchString(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", info.id)
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("requestId", info.id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Int64("bytes", sw.bytes),
+			slog.Float64("durationMs", float64(time.Since(start).Microseconds())/1000),
+			slog.String("user", info.user),
+			slog.String("remote", r.RemoteAddr),
+			slog.String("traceId", traceID(r.Context())),
+		)
+	})
+}
+
+// traceID returns ID of the sampled trace of the request, empty when the request is not traced
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// recordUser saves authenticated user for logs, it runs after authentication
+func recordUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := auth.UserFromContext(r.Context())
+		infoFromContext(r.Context()).user = user
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", user))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setAuditPaths overrides paths recorded in audit log when they differ from query parameters
+func setAuditPaths(r *http.Request, path string, dest string) {
+	info := infoFromContext(r.Context())
+	info.auditPath, info.auditDest, info.audited = path, dest, true
+}
@@ -1,29 +1,140 @@
 package gateway
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/config"
+	"github.com/koan6gi/go-drive/internal/metrics"
 )
 
+const maxHeaderBytes = 1 << 20
+
 func NewRouter() *mux.Router {
 	return mux.NewRouter()
 }
 
 func SetupRouter(router *mux.Router) {
+	router.Use(traceRequests)
+	router.Use(logRequests)
+	router.Use(instrument)
+	router.Use(auth.Middleware)
+	router.Use(recordUser)
+
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+	router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/audit", Audit).Methods(http.MethodGet)
+	router.HandleFunc("/diag", Diag).Methods(http.MethodGet)
+	router.HandleFunc("/healthz", Healthz).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", Readyz).Methods(http.MethodGet)
+
+	router.Handle("/upload", audited("upload", Upload)).Methods(http.MethodPost)
+	router.Handle("/download", audited("download", Download)).Methods(http.MethodGet)
+	router.Handle("/directory", audited("create_directory", CreateDirectory)).Methods(http.MethodPost)
+	router.Handle("/delete", audited("delete", Delete)).Methods(http.MethodDelete)
+	router.Handle("/list", audited("list", List)).Methods(http.MethodGet)
+	router.Handle("/stat", audited("stat", Stat)).Methods(http.MethodGet)
+	router.Handle("/move", audited("move", Move)).Methods(http.MethodPut)
+	router.Handle("/update", audited("update", Update)).Methods(http.MethodPut)
+	router.Handle("/copy", audited("copy", Copy)).Methods(http.MethodPut)
+	router.Handle("/extract", audited("extract", Extract)).Methods(http.MethodPost)
+	router.Handle("/archive", audited("archive", Archive)).Methods(http.MethodPost)
+	router.Handle("/thumbnail", audited("thumbnail", Thumbnail)).Methods(http.MethodGet)
+	router.HandleFunc("/batch", Batch).Methods(http.MethodPost)
 
-	router.HandleFunc("/upload", Upload).Methods(http.MethodPost)
-	router.HandleFunc("/download", Download).Methods(http.MethodGet)
-	router.HandleFunc("/directory", CreateDirectory).Methods(http.MethodPost)
-	router.HandleFunc("/delete", Delete).Methods(http.MethodDelete)
-	router.HandleFunc("/list", List).Methods(http.MethodGet)
-	router.HandleFunc("/move", Move).Methods(http.MethodPut)
-	router.HandleFunc("/update", Update).Methods(http.MethodPut)
-	router.HandleFunc("/copy", Copy).Methods(http.MethodPut)
+	router.HandleFunc("/jobs", ListJobs).Methods(http.MethodGet)
+	router.HandleFunc("/jobs/{id}", GetJob).Methods(http.MethodGet)
+	router.Handle("/jobs/{id}", audited("cancel_job", CancelJob)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/changes", Changes).Methods(http.MethodGet)
+	router.HandleFunc("/events", Events).Methods(http.MethodGet)
+	router.HandleFunc("/events/ws", EventsWebSocket).Methods(http.MethodGet)
+
+	router.Handle("/webhooks", audited("create_webhook", CreateWebhook)).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks", ListWebhooks).Methods(http.MethodGet)
+	router.Handle("/webhooks/{id}", audited("delete_webhook", DeleteWebhook)).Methods(http.MethodDelete)
+	router.HandleFunc("/webhooks/{id}/deliveries", ListDeliveries).Methods(http.MethodGet)
 }
 
-func ListenAndServe(addr string, router *mux.Router) error {
-	return http.ListenAndServe(addr, router)
+// ListenAndServe serves requests until ctx is canceled, then stops accepting connections
+// and waits for active requests to finish during shutdown timeout
+func ListenAndServe(ctx context.Context, cfg *config.Config, router *mux.Router) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+	server.RegisterOnShutdown(stopStreams)
+	servers := []*http.Server{server}
+
+	if cfg.TLS.CertFile != "" {
+		var err error
+		server.TLSConfig, err = tlsConfig(ctx, cfg.TLS)
+		if err != nil {
+			return err
+		}
+
+		if cfg.TLS.RedirectAddr != "" {
+			servers = append(servers, &http.Server{
+				Addr:              cfg.TLS.RedirectAddr,
+				Handler:           redirectHandler(cfg.Server.Addr),
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+				MaxHeaderBytes:    maxHeaderBytes,
+			})
+		}
+	}
+
+	errc := make(chan error, len(servers))
+	for _, v := range servers {
+		go func() {
+			if v.TLSConfig != nil {
+				errc <- v.ListenAndServeTLS("", "")
+			} else {
+				errc <- v.ListenAndServe()
+			}
+		}()
+	}
+
+	// servers which have returned are not waited for after shutdown
+	running := len(servers)
+	var err error
+	select {
+	case err = <-errc:
+		running--
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for active requests", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+
+	for _, v := range servers {
+		serr := v.Shutdown(shutdownCtx)
+		if errors.Is(serr, context.DeadlineExceeded) {
+			log.Printf("shutdown timeout exceeded, closing active connections")
+			serr = v.Close()
+		}
+		err = errors.Join(err, serr)
+	}
+	for range running {
+		if serr := <-errc; !errors.Is(serr, http.ErrServerClosed) {
+			err = errors.Join(err, serr)
+		}
+	}
+
+	return err
 }
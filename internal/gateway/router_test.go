@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/config"
+)
+
+func TestListenAndServeBindFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	cfg := config.Default()
+	cfg.Server.Addr = busy.Addr().String()
+	cfg.Server.ShutdownTimeout = time.Second
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ListenAndServe(context.Background(), cfg, NewRouter())
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("ListenAndServe on a busy address returned nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe didn't return after the listener failed")
+	}
+}
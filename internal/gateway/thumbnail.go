@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+	"github.com/koan6gi/go-drive/internal/thumbnail"
+)
+
+// Thumbnails never change for the same ETag, clients revalidate after an hour
+const thumbnailCacheControl = "private, max-age=3600"
+
+// Thumbnail godoc
+// @Summary Get image thumbnail
+// @Description Get thumbnail of JPEG, PNG, GIF or WebP image fitting into a square of the size.
+// @Description JPEG images get JPEG thumbnails, others get PNG.
+// @Tags Files
+// @Produce image/jpeg
+// @Produce image/png
+// @Param path query string true "Image path"
+// @Param size query int false "Thumbnail size" Enums(64, 128, 256, 512) default(256)
+// @Success 200 {file} file "Thumbnail"
+// @Success 304 {string} string "Not Modified"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 415 {string} string "Unsupported Media Type"
+// @Failure 422 {string} string "Unprocessable Entity"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /thumbnail [get]
+func Thumbnail(w http.ResponseWriter, r *http.Request) {
+	filePath := r.URL.Query().Get("path")
+	if !authorize(w, r, filePath) {
+		return
+	}
+
+	size, err := thumbnail.ParseSize(r.URL.Query().Get("size"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	thumb, err := thumbnail.Thumbnails.Get(r.Context(), filePath, size)
+	if err != nil {
+		var pathErr *repErr.PathError
+		switch {
+		case errors.As(err, &pathErr):
+			code := pathErrorStatus(pathErr)
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(code), pathErr.Error()), code)
+		case r.Context().Err() != nil:
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), err.Error()), http.StatusServiceUnavailable)
+		case errors.Is(err, thumbnail.ErrUnsupported):
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusUnsupportedMediaType), err.Error()), http.StatusUnsupportedMediaType)
+		case errors.Is(err, thumbnail.ErrBadImage):
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusUnprocessableEntity), err.Error()), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	content, err := os.Open(thumb.Path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	fileInfo, err := content.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumb.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", strconv.Quote(thumb.Checksum+"-"+strconv.Itoa(size)))
+	w.Header().Set("Cache-Control", thumbnailCacheControl)
+
+	http.ServeContent(w, r, "", fileInfo.ModTime(), content)
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/koan6gi/go-drive/internal/config"
+)
+
+// Delay before changed certificate is loaded, lets writers replace both files
+const certDebounce = 500 * time.Millisecond
+
+// certificate is a TLS key pair which is reloaded when its files change
+type certificate struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+}
+
+func loadCertificate(certFile string, keyFile string) (*certificate, error) {
+	c := &certificate{
+		mu:       sync.RWMutex{},
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	return c, c.reload()
+}
+
+func (c *certificate) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("can't load certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// watch reloads the certificate on changes in directories of its files,
+// whole directories are watched because files are often replaced by renames or symlink swaps.
+// The previous certificate stays in use when the new one can't be loaded
+func (c *certificate) watch(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("tls: can't watch certificate: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	for _, v := range []string{c.certFile, c.keyFile} {
+		if err := watcher.Add(filepath.Dir(v)); err != nil {
+			log.Printf("tls: can't watch certificate: %v", err)
+			return
+		}
+	}
+
+	debounce := time.NewTimer(certDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			debounce.Reset(certDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("tls: certificate watcher: %v", err)
+		case <-debounce.C:
+			if err := c.reload(); err != nil {
+				log.Printf("tls: %v, keeping previous certificate", err)
+				continue
+			}
+			log.Printf("tls: certificate reloaded")
+		}
+	}
+}
+
+// tlsConfig builds server TLS configuration, certificate is watched until ctx is canceled
+func tlsConfig(ctx context.Context, cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := loadCertificate(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go cert.watch(ctx)
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+	}
+
+	if cfg.ClientAuth == config.ClientAuthNone {
+		return tlsCfg, nil
+	}
+
+	data, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load client CA: %w", err)
+	}
+
+	tlsCfg.ClientCAs = x509.NewCertPool()
+	if !tlsCfg.ClientCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("can't load client CA: no certificates in %s", cfg.ClientCAFile)
+	}
+
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.ClientAuth == config.ClientAuthRequire {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// redirectHandler sends plain HTTP requests to the same URL over HTTPS served on addr
+func redirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/koan6gi/go-drive/internal/repository"
+	"github.com/koan6gi/go-drive/internal/tracing"
+)
+
+// traceRequests starts server span for the request continuing trace context from incoming headers
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("url.query", redactQuery(r.URL.Query())),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// redactQuery returns query with values replaced, they may contain access tokens and file paths
+func redactQuery(query url.Values) string {
+	for key, values := range query {
+		for i := range values {
+			values[i] = "REDACTED"
+		}
+		query[key] = values
+	}
+
+	return query.Encode()
+}
+
+// lockStorage acquires the storage lock inside a span so that lock waits are visible in traces,
+// waiting stops when ctx is done
+func lockStorage(ctx context.Context) error {
+	_, span := tracing.Start(ctx, "storage.Lock")
+	return tracing.End(span, repository.FileStorage.LockContext(ctx))
+}
+
+// lockRequest acquires the storage lock for the request and writes 503 when the request is canceled while waiting
+func lockRequest(w http.ResponseWriter, r *http.Request) bool {
+	if err := lockStorage(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), err.Error()), http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
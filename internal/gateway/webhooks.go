@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/webhooks"
+)
+
+// WebhookRequest is a body of webhook registration
+type WebhookRequest struct {
+	URL    string `json:"url"`
+	Prefix string `json:"prefix"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// CreateWebhook godoc
+// @Summary Register webhook
+// @Description Register URL receiving HMAC signed change events for paths inside prefix.
+// @Description The signature covers the timestamp header, a dot and the body. Internal addresses are refused
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param hook body WebhookRequest true "Webhook"
+// @Success 201 {object} webhooks.Hook "Registered webhook with secret"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /webhooks [post]
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: incorrect body", http.StatusText(http.StatusBadRequest)), http.StatusBadRequest)
+		return
+	}
+
+	hook, err := webhooks.HookManager.Register(auth.UserFromContext(r.Context()), req.URL, req.Prefix, req.Secret)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description Get webhooks registered by the caller
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} webhooks.Hook "Webhooks"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /webhooks [get]
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, webhooks.HookManager.List(auth.UserFromContext(r.Context())))
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete webhook registered by the caller
+// @Tags Webhooks
+// @Produce plain
+// @Param id path string true "Webhook ID"
+// @Success 200 {string} string "delete success"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ok, err := webhooks.HookManager.Delete(auth.UserFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: unknown webhook", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "delete success")
+}
+
+// ListDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Get delivery log of webhook registered by the caller, newest first
+// @Tags Webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {array} webhooks.Delivery "Deliveries"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /webhooks/{id}/deliveries [get]
+func ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, ok := webhooks.HookManager.Deliveries(auth.UserFromContext(r.Context()), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: unknown webhook", http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,326 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+)
+
+// Job statuses
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusCanceled    = "canceled"
+	StatusInterrupted = "interrupted"
+)
+
+// Finished jobs older than retention are dropped on startup
+const retention = 7 * 24 * time.Hour
+
+// Progress of a running job
+type Progress struct {
+	Bytes int64 `json:"bytes"`
+	Items int64 `json:"items"`
+}
+
+// Placement is a final path of a file written by a job
+type Placement struct {
+	Path        string `json:"path"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Overwritten bool   `json:"overwritten,omitempty"`
+}
+
+// Job represents state of a background operation
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Owner      string      `json:"owner,omitempty"`
+	Status     string      `json:"status"`
+	Progress   Progress    `json:"progress"`
+	Result     string      `json:"result,omitempty"`
+	Placements []Placement `json:"placements,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// Func is a job body, returned string is stored as job result
+type Func func(ctx context.Context) (string, error)
+
+type job struct {
+	Job
+	bytes  atomic.Int64
+	items  atomic.Int64
+	cancel context.CancelFunc
+
+	mu         sync.Mutex // guards placements
+	placements []Placement
+}
+
+func (j *job) snapshot() Job {
+	s := j.Job
+	if s.Status == StatusRunning {
+		s.Progress = Progress{
+			Bytes: j.bytes.Load(),
+			Items: j.items.Load(),
+		}
+		s.Placements = j.loadPlacements()
+	}
+	return s
+}
+
+func (j *job) loadPlacements() []Placement {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]Placement(nil), j.placements...)
+}
+
+type Manager struct {
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	jobs      map[string]*job
+	stateFile string
+	stopping  bool
+}
+
+var JobManager *Manager
+
+type ctxKey struct{}
+
+// NewManager loads jobs persisted in stateFile, jobs which were running are marked as interrupted
+func NewManager(stateFile string) (*Manager, error) {
+	m := &Manager{
+		mu:        sync.Mutex{},
+		jobs:      make(map[string]*job),
+		stateFile: stateFile,
+	}
+
+	err := os.MkdirAll(filepath.Dir(stateFile), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []Job
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range saved {
+		if v.FinishedAt != nil && time.Since(*v.FinishedAt) > retention {
+			continue
+		}
+		if v.Status == StatusRunning {
+			v.Status = StatusInterrupted
+		}
+		m.jobs[v.ID] = &job{Job: v}
+	}
+
+	return m, m.save()
+}
+
+// Start runs fn in background and returns snapshot of the created job,
+// job context keeps values of ctx but not its cancellation
+func (m *Manager) Start(ctx context.Context, jobType string, fn Func) Job {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	j := &job{
+		Job: Job{
+			ID:        newID(),
+			Type:      jobType,
+			Owner:     auth.UserFromContext(ctx),
+			Status:    StatusRunning,
+			CreatedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	_ = m.save()
+	snapshot := j.snapshot()
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		result, err := fn(context.WithValue(ctx, ctxKey{}, j))
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		now := time.Now()
+		j.FinishedAt = &now
+		j.Progress = Progress{
+			Bytes: j.bytes.Load(),
+			Items: j.items.Load(),
+		}
+		j.Result = result
+		j.Placements = j.loadPlacements()
+
+		switch {
+		case err == nil:
+			j.Status = StatusSucceeded
+		case ctx.Err() != nil && m.stopping:
+			j.Status = StatusInterrupted
+			j.Error = err.Error()
+		case ctx.Err() != nil:
+			j.Status = StatusCanceled
+			j.Error = err.Error()
+		default:
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		}
+
+		_ = m.save()
+	}()
+
+	return snapshot
+}
+
+// Shutdown waits for running jobs until ctx is done, remaining jobs are canceled and marked as interrupted
+func (m *Manager) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	m.stopping = true
+	for _, v := range m.jobs {
+		if v.Status == StatusRunning {
+			v.cancel()
+		}
+	}
+	m.mu.Unlock()
+
+	<-done
+}
+
+// Get returns job started by owner
+func (m *Manager) Get(owner string, id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok || j.Owner != owner {
+		return Job{}, false
+	}
+
+	return j.snapshot(), true
+}
+
+// List returns jobs started by owner, newest first
+func (m *Manager) List(owner string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Job, 0)
+	for _, v := range m.jobs {
+		if v.Owner == owner {
+			result = append(result, v.snapshot())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// Cancel requests cancellation of running job started by owner
+func (m *Manager) Cancel(owner string, id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok || j.Owner != owner {
+		return Job{}, false
+	}
+
+	if j.Status == StatusRunning && j.cancel != nil {
+		j.cancel()
+	}
+
+	return j.snapshot(), true
+}
+
+// save writes jobs to the state file, caller must hold mu
+func (m *Manager) save() error {
+	saved := make([]Job, 0, len(m.jobs))
+	for _, v := range m.jobs {
+		saved = append(saved, v.snapshot())
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	tmp := m.stateFile + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.stateFile)
+}
+
+// AddProgress adds done bytes and items to the job running with ctx
+func AddProgress(ctx context.Context, bytes int64, items int64) {
+	j, ok := ctx.Value(ctxKey{}).(*job)
+	if !ok {
+		return
+	}
+
+	j.bytes.Add(bytes)
+	j.items.Add(items)
+}
+
+// AddPlacement records final path of a file written by the job running with ctx
+func AddPlacement(ctx context.Context, placement Placement) {
+	j, ok := ctx.Value(ctxKey{}).(*job)
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	j.placements = append(j.placements, placement)
+	j.mu.Unlock()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,598 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/koan6gi/go-drive/internal/events"
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Extraction limits
+const (
+	maxExtractSize    = 1 << 30
+	maxExtractEntries = 10000
+	maxExtractRatio   = 100
+)
+
+// Archive formats
+const (
+	arZip = iota
+	arTar
+	arTarGz
+)
+
+// archiveEntry is a regular file or directory found in an archive, path is its path inside the destination
+type archiveEntry struct {
+	name  string
+	path  fspath.Path
+	isDir bool
+	size  int64
+	open  func() (io.ReadCloser, error)
+}
+
+// archiveSource is a file or directory packed into an archive, files are read from their snapshots
+type archiveSource struct {
+	name  string
+	isDir bool
+	file  itemSnapshot
+}
+
+func archiveFormat(path string) (int, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return arZip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return arTar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return arTarGz, nil
+	}
+
+	return 0, &repErr.PathError{
+		Content: fmt.Sprintf("unsupported archive format: %s", path),
+	}
+}
+
+// archiveEntryPath validates archive entry name and returns its path inside dest directory,
+// only a directory entry like "./" may refer to dest itself
+func archiveEntryPath(dest fspath.Path, name string, isDir bool) (fspath.Path, error) {
+	err := &repErr.PathError{
+		Content: fmt.Sprintf("bad archive entry: %s", name),
+	}
+
+	if strings.HasPrefix(name, "/") {
+		return "", err
+	}
+
+	path := dest
+	for _, v := range strings.Split(name, "/") {
+		if v == "" || v == "." {
+			continue
+		}
+
+		n, nameErr := fspath.Name(v)
+		if nameErr == nil && isTemp(n) {
+			nameErr = fspath.ErrReservedName
+		}
+		if nameErr != nil {
+			err.Err = nameErr
+			return "", err
+		}
+		path = path.Join(n)
+	}
+
+	if (path == dest && !isDir) || len(path) > fspath.MaxPathLength {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// walkArchive calls fn for every file and directory of the archive
+func walkArchive(file contentReader, size int64, format int, fn func(e archiveEntry) error) error {
+	switch format {
+	case arZip:
+		zr, err := zip.NewReader(file, size)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range zr.File {
+			mode := f.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				continue
+			}
+
+			if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > maxExtractRatio {
+				return &repErr.PathError{
+					Content: fmt.Sprintf("suspicious compression ratio: %s", f.Name),
+				}
+			}
+
+			err = fn(archiveEntry{
+				name:  f.Name,
+				isDir: mode.IsDir(),
+				size:  int64(f.UncompressedSize64),
+				open:  f.Open,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case arTar, arTarGz:
+		var r io.Reader = file
+		if format == arTarGz {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			r = gz
+		}
+
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+				continue
+			}
+
+			err = fn(archiveEntry{
+				name:  hdr.Name,
+				isDir: hdr.Typeflag == tar.TypeDir,
+				size:  hdr.Size,
+				open:  func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listArchive reads and validates entries of the archive, content of files can't be opened
+func listArchive(file contentReader, size int64, format int, dest fspath.Path) ([]archiveEntry, error) {
+	var total int64
+	entries := make([]archiveEntry, 0)
+
+	err := walkArchive(file, size, format, func(e archiveEntry) error {
+		path, err := archiveEntryPath(dest, e.name, e.isDir)
+		if err != nil {
+			return err
+		}
+
+		total += e.size
+		if len(entries) >= maxExtractEntries || total > maxExtractSize {
+			return &repErr.PathError{
+				Content: "archive is too large",
+			}
+		}
+
+		e.path, e.open = path, nil
+		entries = append(entries, e)
+		return nil
+	})
+
+	return entries, err
+}
+
+// checkArchive checks entries of the archive against each other and the tree before anything is written,
+// parents of every entry have to be directories both in the archive and in the tree
+func (st *FileSystem) checkArchive(entries []archiveEntry, archive *FSItem, onConflict Conflict) error {
+	// kinds of paths seen in the archive, parents of entries are implicit directories
+	isDir := make(map[string]bool)
+
+	for _, e := range entries {
+		parent := fspath.Root
+		for _, v := range e.path.Dir().Segments() {
+			parent = parent.Join(v)
+			key := st.naming.key(parent.String())
+			if dir, ok := isDir[key]; ok {
+				if !dir {
+					return &repErr.PathError{
+						Content: fmt.Sprintf("archive entry %s is inside file %s", e.name, parent),
+					}
+				}
+				continue
+			}
+			isDir[key] = true
+
+			if item, err := st.getItem(parent); err == nil && item.Type != fsDir {
+				return &repErr.PathError{
+					Content: fmt.Sprintf("not directory: %s", parent),
+				}
+			}
+		}
+
+		key := st.naming.key(e.path.String())
+		if dir, ok := isDir[key]; ok && (!dir || !e.isDir) {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("duplicate archive entry: %s", e.name),
+			}
+		}
+		isDir[key] = e.isDir
+
+		item, err := st.getItem(e.path)
+		switch {
+		case err != nil:
+			continue
+		case e.isDir && item.Type == fsDir:
+			continue
+		case e.isDir:
+			return &repErr.PathError{
+				Err:     repErr.ErrExist,
+				Content: fmt.Sprintf("path %s is already exist", e.path),
+			}
+		case item == archive && onConflict == ConflictOverwrite:
+			return &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite archive being extracted: %s", e.path),
+			}
+		}
+
+		// files are placed like single files, e.g. renamed next to an existing directory
+		if _, _, err := st.resolveFile(e.path, onConflict); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureDirectory creates directory and all missing parents
+func (st *FileSystem) ensureDirectory(ctx context.Context, path fspath.Path) error {
+	current := fspath.Root
+	for _, v := range path.Segments() {
+		current = current.Join(v)
+
+		item, err := st.getItem(current)
+		if err == nil {
+			if item.Type != fsDir {
+				return &repErr.PathError{
+					Content: fmt.Sprintf("not directory: %s", current),
+				}
+			}
+			continue
+		}
+
+		err = st.createDirectory(ctx, current)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Extract unpacks zip, tar or tar.gz archive stored at src into dest directory,
+// existing directories are merged and onConflict applies to existing files.
+// Final paths of files are recorded in the running job, extraction fails when the archive is changed meanwhile.
+// Extraction isn't atomic, entries written before a failure are kept
+func (st *FileSystem) Extract(ctx context.Context, dest string, src string, onConflict Conflict) error {
+	destPath, srcPath, err := parsePaths(dest, src)
+	if err != nil {
+		return err
+	}
+
+	format, err := archiveFormat(src)
+	if err != nil {
+		return err
+	}
+
+	var source itemSnapshot
+	err = st.locked(ctx, func() error {
+		destDir, err := st.getItem(destPath)
+		if err != nil {
+			return err
+		}
+		if destDir.Type != fsDir {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("not directory: %s", dest),
+			}
+		}
+
+		item, err := st.getItem(srcPath)
+		if err != nil {
+			return err
+		}
+		if item.Type != fsFile {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("not file: %s", src),
+			}
+		}
+
+		source = snapshotOf(item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := openContent(source.content)
+	if err != nil {
+		return wrapArchiveError("extract", src, err)
+	}
+	defer file.Close()
+
+	entries, err := listArchive(file, source.content.size, format, destPath)
+	if err == nil {
+		err = st.locked(ctx, func() error {
+			return st.checkArchive(entries, source.item, onConflict)
+		})
+	}
+	if err != nil {
+		return wrapArchiveError("extract", src, err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return wrapArchiveError("extract", src, err)
+	}
+
+	var written int64
+
+	err = walkArchive(file, source.content.size, format, func(e archiveEntry) error {
+		path, _ := archiveEntryPath(destPath, e.name, e.isDir)
+
+		dir := ""
+		var skipped *FSItem
+		err := st.locked(ctx, func() error {
+			if !st.current(source) {
+				return &repErr.PathError{
+					Err:     repErr.ErrChanged,
+					Content: fmt.Sprintf("%s was changed while extracting", src),
+				}
+			}
+			if e.isDir {
+				return st.ensureDirectory(ctx, path)
+			}
+
+			if err := st.ensureDirectory(ctx, path.Dir()); err != nil {
+				return err
+			}
+			if _, existing, _ := st.resolveFile(path, onConflict); existing != nil && onConflict == ConflictSkip {
+				skipped = existing
+				return nil
+			}
+
+			parent, err := st.getItem(path.Dir())
+			if err != nil {
+				return err
+			}
+			dir = parent.Path
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if skipped != nil {
+			Placement{Path: storagePath(skipped), Skipped: true}.report(ctx)
+		}
+		if e.isDir || skipped != nil {
+			jobs.AddProgress(ctx, 0, 1)
+			return nil
+		}
+
+		r, err := e.open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		staged, err := createStaged(dir)
+		if err != nil {
+			return err
+		}
+
+		n, err := copyContext(ctx, staged, io.LimitReader(r, maxExtractSize-written+1))
+		written += n
+		if err == nil && written > maxExtractSize {
+			err = &repErr.PathError{
+				Content: "archive is too large",
+			}
+		}
+		if err == nil {
+			err = staged.Close()
+		}
+		if err != nil {
+			staged.discard()
+			return err
+		}
+
+		err = st.locked(ctx, func() error {
+			item, placement, err := st.install(ctx, staged, path, onConflict)
+			if err != nil {
+				return err
+			}
+			placement.report(ctx)
+			if placement.Skipped {
+				return nil
+			}
+
+			eventType := events.Created
+			if placement.Overwritten {
+				eventType = events.Updated
+			}
+			st.publish(ctx, eventType, item, "")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		jobs.AddProgress(ctx, 0, 1)
+
+		return nil
+	})
+
+	return wrapArchiveError("extract", src, err)
+}
+
+// Archive packs file or directory src into zip archive created at dest,
+// it fails when packed files are changed meanwhile
+func (st *FileSystem) Archive(ctx context.Context, dest string, src string) error {
+	destPath, srcPath, err := parsePaths(dest, src)
+	if err != nil {
+		return err
+	}
+
+	if format, err := archiveFormat(dest); err != nil || format != arZip {
+		return &repErr.PathError{
+			Content: fmt.Sprintf("only zip archives can be created: %s", dest),
+		}
+	}
+
+	var (
+		sources []archiveSource
+		dir     string
+	)
+	err = st.locked(ctx, func() error {
+		item, err := st.getItem(srcPath)
+		if err != nil {
+			return err
+		}
+
+		if err := checkName(destPath); err != nil {
+			return err
+		}
+		if _, _, err := st.resolveFile(destPath, ConflictFail); err != nil {
+			return err
+		}
+		parent, err := st.getParentDirectory(destPath)
+		if err != nil {
+			return err
+		}
+		dir = parent.Path
+
+		base := ""
+		if !srcPath.IsRoot() {
+			base = item.Name
+		}
+		sources = collectArchive(item, base, make([]archiveSource, 0))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	staged, err := createStaged(dir)
+	if err != nil {
+		return wrapArchiveError("create", dest, err)
+	}
+
+	zw := zip.NewWriter(staged)
+	for _, v := range sources {
+		if err = archiveItem(ctx, zw, v); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = staged.Close()
+	}
+	if err != nil {
+		staged.discard()
+		return wrapArchiveError("create", dest, err)
+	}
+
+	return st.locked(ctx, func() error {
+		for _, v := range sources {
+			if !v.isDir && !st.current(v.file) {
+				_ = os.Remove(staged.Name())
+				return &repErr.PathError{
+					Err:     repErr.ErrChanged,
+					Content: fmt.Sprintf("%s was changed while archiving", storagePath(v.file.item)),
+				}
+			}
+		}
+
+		item, _, err := st.install(ctx, staged, destPath, ConflictFail)
+		if err != nil {
+			return err
+		}
+
+		st.publish(ctx, events.Created, item, "")
+		return nil
+	})
+}
+
+// collectArchive appends item and its content to sources
+func collectArchive(item *FSItem, name string, sources []archiveSource) []archiveSource {
+	if item.Type == fsFile {
+		return append(sources, archiveSource{name: name, file: snapshotOf(item)})
+	}
+
+	if name != "" {
+		sources = append(sources, archiveSource{name: name + "/", isDir: true})
+	}
+	for _, v := range item.Entry {
+		sources = collectArchive(v, strings.TrimPrefix(name+"/"+v.Name, "/"), sources)
+	}
+
+	return sources
+}
+
+func archiveItem(ctx context.Context, zw *zip.Writer, v archiveSource) error {
+	if v.isDir {
+		if _, err := zw.Create(v.name); err != nil {
+			return err
+		}
+		jobs.AddProgress(ctx, 0, 1)
+		return nil
+	}
+
+	file, err := openContent(v.file.content)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   v.name,
+		Method: zip.Deflate,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = copyContext(ctx, w, file)
+	if err != nil {
+		return err
+	}
+
+	jobs.AddProgress(ctx, 0, 1)
+
+	return nil
+}
+
+// wrapArchiveError reports unexpected error of the operation on the archive at path as SystemError
+func wrapArchiveError(op string, path string, err error) error {
+	switch err.(type) {
+	case nil, *repErr.PathError, *repErr.SystemError:
+		return err
+	}
+
+	return &repErr.SystemError{
+		Err:     err,
+		Content: fmt.Sprintf("can't %s archive: %s: %v", op, path, err),
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// InvalidateDerived is called with checksum of content which is no longer stored at its path,
+// data derived from the content such as thumbnails can be dropped
+var InvalidateDerived = func(checksum string) {}
+
+// NewHash returns hash used for checksums of stored files
+func NewHash() hash.Hash {
+	return sha256.New()
+}
+
+func hashFile(ctx context.Context, c content) (string, error) {
+	file, err := openContent(c)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := NewHash()
+	if _, err := copyContext(ctx, h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checksum returns hex encoded SHA-256 of the file content. Checksums of written files are
+// computed while writing, others are computed and stored on first use
+func (f *File) Checksum() (string, error) {
+	if f.item.Checksum == "" {
+		checksum, err := hashFile(f.ctx, f.item.content())
+		if err != nil {
+			return "", &repErr.SystemError{
+				Err:     err,
+				Content: fmt.Sprintf("can't hash file: %s: %v", f.item.Path, err),
+			}
+		}
+
+		f.item.Checksum = checksum
+		if err := f.st.saveItems(f.item); err != nil {
+			return "", err
+		}
+	}
+
+	return f.item.Checksum, nil
+}
+
+// setChecksum stores checksum of the item content, data derived from the previous content is dropped
+func (st *FileSystem) setChecksum(item *FSItem, checksum string) error {
+	if item.Checksum == checksum {
+		return nil
+	}
+
+	if item.Checksum != "" {
+		InvalidateDerived(item.Checksum)
+	}
+	item.Checksum = checksum
+
+	return st.saveItems(item)
+}
+
+// invalidate drops data derived from content of files inside item
+func invalidate(item *FSItem) {
+	if item.Type == fsFile {
+		if item.Checksum != "" {
+			InvalidateDerived(item.Checksum)
+		}
+		return
+	}
+
+	for _, v := range item.Entry {
+		invalidate(v)
+	}
+}
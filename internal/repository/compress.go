@@ -0,0 +1,422 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the encoding of stored content of compressible files. Compressed files are split
+// into independent frames of frameSize plain bytes, so reading from any offset decompresses at most one
+// frame before it. Frame sizes are kept in the index, files can't be read without it
+type Compression string
+
+// Compression encodings
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compress is the encoding of new compressible files, configured on startup
+var Compress = CompressionNone
+
+const (
+	frameSize = 1 << 20
+	// smaller files are stored as is
+	minCompressSize = 1024
+	// compressed content is kept when it saves at least 1/minSavings of the size
+	minSavings = 10
+	// number of changed files waiting for compression
+	compressQueueSize = 1024
+)
+
+var errCompressed = errors.New("compressed file can only be rewritten from the start")
+
+// Content types worth compressing in addition to text/*, +json and +xml types
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/x-ndjson":   true,
+	"application/xml":        true,
+	"application/javascript": true,
+	"application/yaml":       true,
+	"application/x-yaml":     true,
+	"application/toml":       true,
+	"application/sql":        true,
+	"application/x-sh":       true,
+	"application/rtf":        true,
+	"application/postscript": true,
+	"application/x-tar":      true,
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") || compressibleTypes[mediaType]
+}
+
+// content describes how content of a stored file is laid out on disk,
+// it's a snapshot which can be used without the lock
+type content struct {
+	path     string
+	size     int64
+	encoding Compression
+	frames   []int64
+}
+
+func (item *FSItem) content() content {
+	return content{path: item.Path, size: item.Size, encoding: item.Encoding, frames: item.Frames}
+}
+
+// diskSize returns size of the item file on disk
+func (item *FSItem) diskSize() int64 {
+	if item.Encoding == "" {
+		return item.Size
+	}
+
+	var size int64
+	for _, v := range item.Frames {
+		size += v
+	}
+	return size
+}
+
+// inherit copies metadata of the same content from prev to the item scanned from disk
+func (item *FSItem) inherit(prev *FSItem) {
+	item.Size = prev.Size
+	item.Encoding = prev.Encoding
+	item.Frames = prev.Frames
+	item.Checksum = prev.Checksum
+}
+
+// plain marks content of the item as not compressed
+func (item *FSItem) plain() {
+	item.Encoding = ""
+	item.Frames = nil
+}
+
+// contentReader reads plain content of a stored file
+type contentReader interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// openContent opens plain content of the file
+func openContent(c content) (contentReader, error) {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.encoding == "" {
+		return file, nil
+	}
+
+	return &decoder{file: file, c: c}, nil
+}
+
+func shouldCompress(item *FSItem) bool {
+	return Compress != CompressionNone && item.Type == fsFile && item.Encoding == "" &&
+		item.Size >= minCompressSize && compressible(item.ContentType)
+}
+
+// compress schedules compression of the changed file, it never blocks the caller
+func (st *FileSystem) compress(item *FSItem) {
+	if !shouldCompress(item) {
+		return
+	}
+
+	select {
+	case st.compressQueue <- item:
+	default:
+		log.Printf("storage: compression queue is full, %s stays plain", item.Path)
+	}
+}
+
+// Compressor compresses changed files until ctx is done. Files are encoded without the lock,
+// it's only taken to replace content which hasn't changed meanwhile
+func (st *FileSystem) Compressor(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-st.compressQueue:
+			st.compressItem(item)
+		}
+	}
+}
+
+// compressItem replaces plain content of the file with compressed one when it's worth it,
+// content stays plain when compression fails
+func (st *FileSystem) compressItem(item *FSItem) {
+	st.Lock()
+	ok := shouldCompress(item)
+	target := snapshotOf(item)
+	st.Unlock()
+	if !ok {
+		return
+	}
+
+	tmp, frames, err := encodeFile(target.content.path, Compress)
+	if err != nil {
+		log.Printf("storage: can't compress %s: %v", target.content.path, err)
+		return
+	}
+	defer os.Remove(tmp)
+
+	var size int64
+	for _, v := range frames {
+		size += v
+	}
+	if size > target.content.size-target.content.size/minSavings {
+		return
+	}
+
+	st.Lock()
+	defer st.Unlock()
+
+	if !st.unchanged(target) {
+		return
+	}
+
+	// the watcher sees the same modification time, so the file isn't reported as changed
+	err = os.Chtimes(tmp, item.ModTime, item.ModTime)
+	if err == nil {
+		err = os.Rename(tmp, item.Path)
+	}
+	if err != nil {
+		log.Printf("storage: can't compress %s: %v", item.Path, err)
+		return
+	}
+
+	item.Encoding = Compress
+	item.Frames = frames
+	if info, err := os.Stat(item.Path); err == nil {
+		item.ModTime = info.ModTime()
+	}
+
+	if err := st.saveItems(item); err != nil {
+		log.Printf("storage: %v", err)
+	}
+}
+
+// encodeFile writes compressed copy of the file next to it and returns the copy path and its frame sizes
+func encodeFile(path string, encoding Compression) (string, []int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+
+	dst, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"compress-*")
+	if err != nil {
+		return "", nil, err
+	}
+
+	frames, err := encodeFrames(dst, src, encoding)
+	if err == nil {
+		err = dst.Chmod(info.Mode().Perm())
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", nil, err
+	}
+
+	return dst.Name(), frames, nil
+}
+
+func encodeFrames(w io.Writer, r io.Reader, encoding Compression) ([]int64, error) {
+	var zw *zstd.Encoder
+	if encoding == CompressionZstd {
+		var err error
+		zw, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
+	}
+
+	frames := make([]int64, 0)
+	chunk := make([]byte, frameSize)
+	frame := bytes.Buffer{}
+
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			frame.Reset()
+			switch encoding {
+			case CompressionGzip:
+				gw := gzip.NewWriter(&frame)
+				if _, err := gw.Write(chunk[:n]); err != nil {
+					return nil, err
+				}
+				if err := gw.Close(); err != nil {
+					return nil, err
+				}
+			case CompressionZstd:
+				frame.Write(zw.EncodeAll(chunk[:n], nil))
+			default:
+				return nil, fmt.Errorf("unknown compression %q", encoding)
+			}
+
+			if _, err := w.Write(frame.Bytes()); err != nil {
+				return nil, err
+			}
+			frames = append(frames, int64(frame.Len()))
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decoder reads plain content of a compressed file, seeking reopens the frame of the new offset
+type decoder struct {
+	file *os.File
+	c    content
+	pos  int64
+	// decompressed frame positioned at pos, nil when it has to be opened
+	r  io.Reader
+	gz *gzip.Reader
+	zr *zstd.Decoder
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	if d.pos >= d.c.size {
+		return 0, io.EOF
+	}
+
+	if d.r == nil {
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	end := min(d.c.size, (d.pos/frameSize+1)*frameSize)
+	if int64(len(p)) > end-d.pos {
+		p = p[:end-d.pos]
+	}
+
+	n, err := d.r.Read(p)
+	d.pos += int64(n)
+	if d.pos == end {
+		d.r = nil
+		return n, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// open starts decompression of the frame containing pos
+func (d *decoder) open() error {
+	index := int(d.pos / frameSize)
+	if index >= len(d.c.frames) {
+		return io.ErrUnexpectedEOF
+	}
+
+	var offset int64
+	for _, v := range d.c.frames[:index] {
+		offset += v
+	}
+	section := io.NewSectionReader(d.file, offset, d.c.frames[index])
+
+	var err error
+	switch d.c.encoding {
+	case CompressionGzip:
+		if d.gz == nil {
+			d.gz, err = gzip.NewReader(section)
+		} else {
+			err = d.gz.Reset(section)
+		}
+		d.r = d.gz
+	case CompressionZstd:
+		if d.zr == nil {
+			d.zr, err = zstd.NewReader(section, zstd.WithDecoderConcurrency(1))
+		} else {
+			err = d.zr.Reset(section)
+		}
+		d.r = d.zr
+	default:
+		err = fmt.Errorf("unknown compression %q", d.c.encoding)
+	}
+	if err != nil {
+		d.r = nil
+		return err
+	}
+
+	skip := d.pos - int64(index)*frameSize
+	if _, err := io.CopyN(io.Discard, d.r, skip); err != nil {
+		d.r = nil
+		return err
+	}
+
+	return nil
+}
+
+func (d *decoder) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.c.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek to negative offset")
+	}
+
+	if offset != d.pos {
+		d.pos = offset
+		d.r = nil
+	}
+
+	return offset, nil
+}
+
+// ReadAt reads with a separate decoder, so it doesn't move the offset of d
+func (d *decoder) ReadAt(p []byte, off int64) (int, error) {
+	r := &decoder{file: d.file, c: d.c, pos: off}
+	defer r.release()
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF && off+int64(n) >= d.c.size {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (d *decoder) release() {
+	if d.zr != nil {
+		d.zr.Close()
+	}
+}
+
+func (d *decoder) Close() error {
+	d.release()
+	return d.file.Close()
+}
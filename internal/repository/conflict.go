@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Conflict selects what happens when the target of create, copy, move or extract already exists
+type Conflict string
+
+// Conflict policies
+const (
+	ConflictFail      Conflict = "fail"
+	ConflictOverwrite Conflict = "overwrite"
+	ConflictRename    Conflict = "rename"
+	ConflictSkip      Conflict = "skip"
+)
+
+// Renamed items get the first free suffix up to this number
+const maxRenameSuffix = 10000
+
+// ParseConflict parses conflict policy, empty string means ConflictFail
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(s); c {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip:
+		return c, nil
+	}
+
+	return "", fmt.Errorf("unknown conflict policy %q, expected fail, overwrite, rename or skip", s)
+}
+
+// Placement is the final path of the target, Skipped means the existing item was kept
+// and Overwritten means content of the existing file was replaced
+type Placement struct {
+	Path        string `json:"path"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Overwritten bool   `json:"overwritten,omitempty"`
+}
+
+// report records the placement in the job running with ctx
+func (p Placement) report(ctx context.Context) {
+	jobs.AddPlacement(ctx, jobs.Placement(p))
+}
+
+// resolveFile resolves conflict of a new file at target with an existing item, the item is returned
+// when it's kept or overwritten, otherwise the file has to be created at the returned path
+func (st *FileSystem) resolveFile(target fspath.Path, onConflict Conflict) (fspath.Path, *FSItem, error) {
+	dir, err := st.getParentDirectory(target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := st.naming.name(target.Base())
+	item, ok := dir.Entry[st.naming.key(name)]
+	if !ok {
+		return target, nil, nil
+	}
+
+	switch onConflict {
+	case ConflictOverwrite:
+		if item.Type != fsFile {
+			return "", nil, &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite directory %s with file", storagePath(item)),
+			}
+		}
+		return fspath.Path(storagePath(item)), item, nil
+	case ConflictSkip:
+		return fspath.Path(storagePath(item)), item, nil
+	case ConflictRename:
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if base == "" {
+			base, ext = name, ""
+		}
+		for i := 1; i <= maxRenameSuffix; i++ {
+			candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+			if _, ok := dir.Entry[st.naming.key(candidate)]; !ok {
+				renamed := target.Dir().Join(candidate)
+				return renamed, nil, checkName(renamed)
+			}
+		}
+		return "", nil, &repErr.PathError{
+			Err:     repErr.ErrExist,
+			Content: fmt.Sprintf("can't find free name for %s", target),
+		}
+	}
+
+	return "", nil, st.checkCollision(dir, name)
+}
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sys/unix"
+)
+
+// MinFreeSpace is the free space in the storage directory required for readiness, configured on startup
+var MinFreeSpace int64 = 100 << 20
+
+// Time to wait for the storage lock before cached stats are reported
+const statsWait = time.Second
+
+// Stats describes stored content, StoredBytes is the size on disk of compressed files
+type Stats struct {
+	Files       int64 `json:"files"`
+	Directories int64 `json:"directories"`
+	Bytes       int64 `json:"bytes"`
+	StoredBytes int64 `json:"storedBytes"`
+}
+
+// Stats counts items of the tree, caller must hold the lock
+func (st *FileSystem) Stats() Stats {
+	var stats Stats
+
+	var walk func(item *FSItem)
+	walk = func(item *FSItem) {
+		for _, v := range item.Entry {
+			if v.Type == fsDir {
+				stats.Directories++
+				walk(v)
+				continue
+			}
+			stats.Files++
+			stats.Bytes += v.Size
+			stats.StoredBytes += v.diskSize()
+		}
+	}
+	walk(st.st)
+
+	return stats
+}
+
+// cachedStats keeps the last counted stats, so that readers are not blocked by long operations
+type cachedStats struct {
+	mu         sync.Mutex
+	last       Stats
+	updated    time.Time
+	refreshing atomic.Bool
+}
+
+// cachedStats recounts the tree if the lock is acquired in time, otherwise the last stats are returned.
+// The returned time is when the stats were counted
+func (st *FileSystem) cachedStats() (Stats, time.Time) {
+	c := &st.stats
+
+	if c.refreshing.CompareAndSwap(false, true) {
+		done := make(chan struct{})
+		go func() {
+			defer c.refreshing.Store(false)
+			defer close(done)
+
+			st.Lock()
+			stats := st.Stats()
+			st.Unlock()
+
+			c.mu.Lock()
+			c.last, c.updated = stats, time.Now()
+			c.mu.Unlock()
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(statsWait):
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last, c.updated
+}
+
+// lockStats describes contention on the storage lock
+type lockStats struct {
+	acquisitions atomic.Int64
+	waitTotal    atomic.Int64
+	waitMax      atomic.Int64
+	waiting      atomic.Int64
+	heldSince    atomic.Int64
+}
+
+func (l *lockStats) acquired(wait time.Duration) {
+	l.heldSince.Store(time.Now().UnixNano())
+	l.acquisitions.Add(1)
+	l.waitTotal.Add(int64(wait))
+	for {
+		max := l.waitMax.Load()
+		if int64(wait) <= max || l.waitMax.CompareAndSwap(max, int64(wait)) {
+			return
+		}
+	}
+}
+
+type LockDiagnostics struct {
+	Acquisitions int64   `json:"acquisitions"`
+	WaitTotal    float64 `json:"waitTotalSeconds"`
+	WaitMax      float64 `json:"waitMaxSeconds"`
+	Waiting      int64   `json:"waiting"`
+	HeldFor      float64 `json:"heldForSeconds"`
+}
+
+type DiskDiagnostics struct {
+	TotalBytes uint64 `json:"totalBytes"`
+	FreeBytes  uint64 `json:"freeBytes"`
+}
+
+type MetadataDiagnostics struct {
+	File             string `json:"file"`
+	Size             int64  `json:"size"`
+	Items            int    `json:"items"`
+	Journal          int    `json:"journal"`
+	LastID           uint64 `json:"lastChangeId"`
+	Error            string `json:"error,omitempty"`
+	OpenTransactions int    `json:"openTransactions"`
+}
+
+// Diagnostics describes state of the storage backend
+type Diagnostics struct {
+	Backend            string              `json:"backend"`
+	Root               string              `json:"root"`
+	DataDirectory      string              `json:"dataDirectory"`
+	Naming             NamePolicy          `json:"naming"`
+	Compression        Compression         `json:"compression"`
+	Ready              bool                `json:"ready"`
+	Error              string              `json:"error,omitempty"`
+	Tree               Stats               `json:"tree"`
+	TreeCountedAt      time.Time           `json:"treeCountedAt"`
+	Lock               LockDiagnostics     `json:"lock"`
+	OpenFiles          int64               `json:"openFiles"`
+	ProcessFileHandles int                 `json:"processFileHandles"`
+	Disk               DiskDiagnostics     `json:"disk"`
+	Metadata           MetadataDiagnostics `json:"metadata"`
+	Scrub              ScrubReport         `json:"scrub"`
+}
+
+func freeSpace(path string) (DiskDiagnostics, error) {
+	var fs unix.Statfs_t
+	err := unix.Statfs(path, &fs)
+	if err != nil {
+		return DiskDiagnostics{}, err
+	}
+
+	return DiskDiagnostics{
+		TotalBytes: fs.Blocks * uint64(fs.Bsize),
+		FreeBytes:  fs.Bavail * uint64(fs.Bsize),
+	}, nil
+}
+
+// Ready checks that the storage can serve requests: the storage directory is writable,
+// metadata is readable and there is enough free space
+func (st *FileSystem) Ready() error {
+	err := unix.Access(StorageDirectory, unix.W_OK)
+	if err != nil {
+		return fmt.Errorf("storage directory is not writable: %w", err)
+	}
+
+	err = st.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(itemsBucket) == nil {
+			return errors.New("items bucket is missing")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("metadata is not loaded: %w", err)
+	}
+
+	disk, err := freeSpace(StorageDirectory)
+	if err != nil {
+		return fmt.Errorf("can't get free space: %w", err)
+	}
+	if MinFreeSpace > 0 && disk.FreeBytes < uint64(MinFreeSpace) {
+		return fmt.Errorf("free space %d is below %d bytes", disk.FreeBytes, MinFreeSpace)
+	}
+
+	return nil
+}
+
+func (st *FileSystem) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		Backend:       "fs",
+		Root:          StorageDirectory,
+		DataDirectory: DataDirectory,
+		Naming:        st.naming,
+		Compression:   Compress,
+		OpenFiles:     st.openFiles.Load(),
+		Lock: LockDiagnostics{
+			Acquisitions: st.lock.acquisitions.Load(),
+			WaitTotal:    time.Duration(st.lock.waitTotal.Load()).Seconds(),
+			WaitMax:      time.Duration(st.lock.waitMax.Load()).Seconds(),
+			Waiting:      st.lock.waiting.Load(),
+		},
+		ProcessFileHandles: -1,
+		Scrub:              st.scrub.snapshot(),
+	}
+
+	if since := st.lock.heldSince.Load(); since != 0 {
+		d.Lock.HeldFor = time.Since(time.Unix(0, since)).Seconds()
+	}
+
+	if err := st.Ready(); err != nil {
+		d.Error = err.Error()
+	} else {
+		d.Ready = true
+	}
+
+	d.Tree, d.TreeCountedAt = st.cachedStats()
+	d.Disk, _ = freeSpace(StorageDirectory)
+
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		d.ProcessFileHandles = len(fds)
+	}
+
+	d.Metadata.File = st.db.Path()
+	if info, err := os.Stat(d.Metadata.File); err == nil {
+		d.Metadata.Size = info.Size()
+	}
+	d.Metadata.OpenTransactions = st.db.Stats().OpenTxN
+	d.Metadata.LastID = st.LastChangeID()
+	err := st.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(itemsBucket); b != nil {
+			d.Metadata.Items = b.Stats().KeyN
+		}
+		if b := tx.Bucket(journalBucket); b != nil {
+			d.Metadata.Journal = b.Stats().KeyN
+		}
+		return nil
+	})
+	if err != nil {
+		d.Metadata.Error = err.Error()
+	}
+
+	return d
+}
@@ -1,5 +1,14 @@
 package errors
 
+import "errors"
+
+// Reasons of path errors, use errors.Is to check them
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExist    = errors.New("already exists")
+	ErrChanged  = errors.New("changed meanwhile")
+)
+
 type PathError struct {
 	Err     error
 	Content string
@@ -7,9 +16,18 @@ type PathError struct {
 
 func (e *PathError) Error() string { return e.Content }
 
+func (e *PathError) Unwrap() error { return e.Err }
+
 type SystemError struct {
 	Err     error
 	Content string
 }
 
 func (e *SystemError) Error() string { return e.Content }
+
+// CursorError means changes after the cursor are no longer kept and the client has to resync
+type CursorError struct {
+	Content string
+}
+
+func (e *CursorError) Error() string { return e.Content }
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/events"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Journal settings
+const (
+	maxJournalEntries = 100000
+	compactEvery      = 1000
+)
+
+var (
+	journalBucket = []byte("journal")
+	floorKey      = []byte("journal-floor")
+	gapKey        = []byte("journal-gap")
+	metaBucket    = []byte("meta")
+)
+
+// ChangeSet is a page of the change journal
+type ChangeSet struct {
+	Changes       []events.Event `json:"changes"`
+	Cursor        string         `json:"cursor"`
+	HasMore       bool           `json:"hasMore"`
+	ResetRequired bool           `json:"resetRequired,omitempty"`
+}
+
+func newEvent(eventType string, item *FSItem, oldPath string) events.Event {
+	itemType := deFile
+	if item.Type == fsDir {
+		itemType = deDir
+	}
+
+	return events.Event{
+		Type:     eventType,
+		ItemType: itemType,
+		Path:     storagePath(item),
+		OldPath:  oldPath,
+		Size:     item.Size,
+		Time:     time.Now(),
+	}
+}
+
+// publish records event about change of the item made by user from ctx and emits it,
+// events of a transaction are emitted on commit
+func (st *FileSystem) publish(ctx context.Context, eventType string, item *FSItem, oldPath string) {
+	e := newEvent(eventType, item, oldPath)
+	e.User = auth.UserFromContext(ctx)
+
+	if tx := transactionFromContext(ctx); tx != nil {
+		tx.events = append(tx.events, func() { st.emit(e) })
+		return
+	}
+
+	st.emit(e)
+}
+
+// publishExternal records event about change made outside of the API and emits it
+func (st *FileSystem) publishExternal(eventType string, item *FSItem, oldPath string) {
+	e := newEvent(eventType, item, oldPath)
+	e.External = true
+
+	st.emit(e)
+}
+
+// emit records the event and publishes it with the journal ID, an event which can't be recorded
+// is replaced with a reset marker, and cursors before it require reset
+func (st *FileSystem) emit(e events.Event) {
+	err := st.record(&e)
+	if err != nil {
+		log.Printf("change journal: %s %s is lost: %v", e.Type, e.Path, err)
+		st.markGap(st.LastChangeID() + 1)
+		events.EventBus.Reset()
+		return
+	}
+
+	events.EventBus.Publish(e)
+}
+
+// markGap requires reset from cursors before gap, the gap is saved with the next recorded change
+// when it can't be saved now
+func (st *FileSystem) markGap(gap uint64) {
+	st.journalGap.Store(max(st.journalGap.Load(), gap))
+
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		return st.saveGap(tx)
+	})
+	if err != nil {
+		log.Printf("change journal: can't save gap: %v", err)
+	}
+}
+
+// saveGap writes the gap to the journal meta when it's newer than the saved one
+func (st *FileSystem) saveGap(tx *bolt.Tx) error {
+	gap := st.journalGap.Load()
+	if gap == 0 {
+		return nil
+	}
+
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	if saved := meta.Get(gapKey); saved != nil && binary.BigEndian.Uint64(saved) >= gap {
+		return nil
+	}
+
+	return meta.Put(gapKey, journalKey(gap))
+}
+
+// loadGap restores the gap saved by markGap
+func (st *FileSystem) loadGap() error {
+	return st.db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			if gap := meta.Get(gapKey); gap != nil {
+				st.journalGap.Store(binary.BigEndian.Uint64(gap))
+			}
+		}
+		return nil
+	})
+}
+
+// LostChangesAfter returns ID of the last change recorded before a change which couldn't be recorded
+func (st *FileSystem) LostChangesAfter() (uint64, bool) {
+	gap := st.journalGap.Load()
+	return gap - 1, gap != 0
+}
+
+func journalKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// record appends event to the journal and assigns its ID
+func (st *FileSystem) record(e *events.Event) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(journalBucket)
+		if err != nil {
+			return err
+		}
+
+		e.ID, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		err = b.Put(journalKey(e.ID), data)
+		if err != nil {
+			return err
+		}
+
+		err = st.saveGap(tx)
+		if err != nil {
+			return err
+		}
+
+		if e.ID%compactEvery == 0 {
+			return compactJournal(tx, b)
+		}
+		return nil
+	})
+}
+
+// compactJournal drops the oldest entries above the journal limit and moves the floor
+func compactJournal(tx *bolt.Tx, b *bolt.Bucket) error {
+	excess := b.Stats().KeyN - maxJournalEntries
+	if excess <= 0 {
+		return nil
+	}
+
+	keys := make([][]byte, 0, excess)
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && len(keys) < excess; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	for _, v := range keys {
+		if err := b.Delete(v); err != nil {
+			return err
+		}
+	}
+
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+
+	return meta.Put(floorKey, keys[len(keys)-1])
+}
+
+// LastChangeID returns ID of the last recorded change
+func (st *FileSystem) LastChangeID() uint64 {
+	var id uint64
+
+	_ = st.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(journalBucket); b != nil {
+			id = b.Sequence()
+		}
+		return nil
+	})
+
+	return id
+}
+
+// Changes returns up to limit changes inside prefix recorded after cursor and visible to user from ctx,
+// empty cursor returns no changes and the current cursor, it is safe to call without Lock
+func (st *FileSystem) Changes(ctx context.Context, prefix string, cursor string, limit int) (*ChangeSet, error) {
+	set := &ChangeSet{
+		Changes: make([]events.Event, 0),
+	}
+	user := auth.UserFromContext(ctx)
+
+	if prefix != "" {
+		p, err := parsePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+		prefix = p.String()
+	}
+
+	var after uint64
+	if cursor != "" {
+		var err error
+		after, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, &repErr.PathError{
+				Content: "bad cursor: " + cursor,
+			}
+		}
+	}
+
+	expired := false
+
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(journalBucket)
+		if b == nil {
+			set.Cursor = strconv.FormatUint(after, 10)
+			return nil
+		}
+
+		last := b.Sequence()
+		if cursor == "" || after > last {
+			set.Cursor = strconv.FormatUint(last, 10)
+			return nil
+		}
+
+		if gap := st.journalGap.Load(); gap != 0 && after < gap {
+			expired = true
+			set.ResetRequired = true
+			set.Cursor = strconv.FormatUint(last, 10)
+			return nil
+		}
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			if floor := meta.Get(floorKey); floor != nil && after < binary.BigEndian.Uint64(floor) {
+				expired = true
+				set.ResetRequired = true
+				set.Cursor = strconv.FormatUint(last, 10)
+				return nil
+			}
+		}
+
+		next := after
+		c := b.Cursor()
+		for k, v := c.Seek(journalKey(after + 1)); k != nil; k, v = c.Next() {
+			if len(set.Changes) == limit {
+				set.HasMore = true
+				break
+			}
+
+			var e events.Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			next = e.ID
+
+			if e.Matches(prefix) && auth.CanAccessAny(user, e.Path, e.OldPath) {
+				set.Changes = append(set.Changes, e)
+			}
+		}
+
+		set.Cursor = strconv.FormatUint(next, 10)
+		return nil
+	})
+	if err != nil {
+		return nil, &repErr.SystemError{
+			Err:     err,
+			Content: "can't read change journal: " + err.Error(),
+		}
+	}
+
+	if expired {
+		return set, &repErr.CursorError{
+			Content: "cursor is too old, reset required",
+		}
+	}
+
+	return set, nil
+}
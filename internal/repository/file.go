@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/events"
+)
+
+// File is an opened storage file, metadata of the file is updated on Close.
+// Compressed files are read as plain content and can only be written after truncating to zero.
+// Staged files are written next to the stored file and replace it on Close, Abort drops them
+type File struct {
+	*os.File
+	st   *FileSystem
+	item *FSItem
+	ctx  context.Context
+	// event published on Close, created files are always reported, updated only when changed
+	event  string
+	closed bool
+	// hash of content written from the start of the file, nil when the file isn't written sequentially
+	hash hash.Hash
+	// decoder of compressed content, nil for plain files
+	dec *decoder
+	// staged content replaces item on Close
+	staged bool
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.dec != nil {
+		return 0, errCompressed
+	}
+
+	n, err := f.File.Write(p)
+	if f.hash != nil {
+		f.hash.Write(p[:n])
+		if err != nil {
+			f.hash = nil
+		}
+	}
+	return n, err
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// ReadFrom is used by io.Copy, content is hashed on the way to the file
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	if f.dec != nil {
+		return 0, errCompressed
+	}
+	if f.hash == nil {
+		return f.File.ReadFrom(r)
+	}
+
+	n, err := f.File.ReadFrom(io.TeeReader(r, f.hash))
+	if err != nil {
+		f.hash = nil
+	}
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if f.dec != nil {
+		return 0, errCompressed
+	}
+
+	f.hash = nil
+	return f.File.WriteAt(p, off)
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.dec != nil {
+		return f.dec.Read(p)
+	}
+
+	f.hash = nil
+	return f.File.Read(p)
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.dec != nil {
+		return f.dec.ReadAt(p, off)
+	}
+
+	return f.File.ReadAt(p, off)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.dec != nil {
+		return f.dec.Seek(offset, whence)
+	}
+
+	f.hash = nil
+	return f.File.Seek(offset, whence)
+}
+
+// Truncate to zero at the start of the file begins hashing of the new content
+func (f *File) Truncate(size int64) error {
+	if f.dec != nil && size != 0 {
+		return errCompressed
+	}
+
+	f.hash = nil
+	err := f.File.Truncate(size)
+	if err != nil {
+		return err
+	}
+
+	if f.dec != nil {
+		f.dec.release()
+		f.dec = nil
+		f.item.plain()
+	}
+
+	if offset, err := f.File.Seek(0, io.SeekCurrent); err == nil && size == 0 && offset == 0 {
+		f.hash = NewHash()
+	}
+	return nil
+}
+
+// ModTime returns modification time of the stored file
+func (f *File) ModTime() time.Time {
+	return f.item.ModTime
+}
+
+// Snapshot opens plain content of the file which can be read without the lock,
+// content replaced later stays as it was when the snapshot was opened
+func (f *File) Snapshot() (io.ReadSeekCloser, error) {
+	return openContent(f.item.content())
+}
+
+// Abort closes the file, content of staged file is dropped and the stored file stays unchanged.
+// Other files are closed as usual
+func (f *File) Abort() error {
+	if !f.staged || f.closed {
+		return f.Close()
+	}
+
+	f.closed = true
+	f.st.openFiles.Add(-1)
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+func (f *File) Close() error {
+	if f.staged {
+		return f.install()
+	}
+
+	if !f.closed {
+		f.closed = true
+		f.st.openFiles.Add(-1)
+	}
+
+	if f.dec != nil {
+		f.dec.release()
+	}
+
+	err := f.File.Close()
+	if err != nil {
+		return err
+	}
+
+	changed, err := f.st.refresh(f.item)
+	if err != nil {
+		return err
+	}
+
+	if f.hash != nil {
+		err = f.st.setChecksum(f.item, hex.EncodeToString(f.hash.Sum(nil)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if changed {
+		f.st.compress(f.item)
+	}
+
+	if f.event != "" && (changed || f.event == events.Created) {
+		f.st.publish(f.ctx, f.event, f.item, "")
+	}
+
+	return nil
+}
+
+// install replaces the stored file with staged content, it's done once
+func (f *File) install() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.st.openFiles.Add(-1)
+
+	err := f.File.Close()
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	checksum := ""
+	if f.hash != nil {
+		checksum = hex.EncodeToString(f.hash.Sum(nil))
+	}
+	if err := f.st.replace(f.item, f.Name(), checksum); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if f.event != "" {
+		f.st.publish(f.ctx, f.event, f.item, "")
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/koan6gi/go-drive/internal/metrics"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+	"github.com/koan6gi/go-drive/internal/tracing"
+)
+
+// instrumented traces storage operations and counts their errors by type
+type instrumented struct {
+	Storage
+}
+
+// Instrument wraps storage to trace its operations and export errors as metrics
+func Instrument(s Storage) Storage {
+	return &instrumented{Storage: s}
+}
+
+func observe(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pathErr *repErr.PathError
+	var systemErr *repErr.SystemError
+	var cursorErr *repErr.CursorError
+
+	kind := "other"
+	switch {
+	case errors.As(err, &pathErr):
+		kind = "path"
+	case errors.As(err, &systemErr):
+		kind = "system"
+	case errors.As(err, &cursorErr):
+		kind = "cursor"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		kind = "canceled"
+	}
+	metrics.StorageErrors.WithLabelValues(op, kind).Inc()
+
+	return err
+}
+
+// finish records err in span and metrics
+func finish(span trace.Span, op string, err error) error {
+	return tracing.End(span, observe(op, err))
+}
+
+func (s *instrumented) CreateFile(ctx context.Context, path string, onConflict Conflict) (*File, Placement, error) {
+	ctx, span := tracing.Start(ctx, "storage.CreateFile", attribute.String("path", path), attribute.String("on_conflict", string(onConflict)))
+	file, placement, err := s.Storage.CreateFile(ctx, path, onConflict)
+	return file, placement, finish(span, "create_file", err)
+}
+
+func (s *instrumented) CreateDirectory(ctx context.Context, path string) error {
+	ctx, span := tracing.Start(ctx, "storage.CreateDirectory", attribute.String("path", path))
+	return finish(span, "create_directory", s.Storage.CreateDirectory(ctx, path))
+}
+
+func (s *instrumented) GetFile(ctx context.Context, path string) (*File, error) {
+	ctx, span := tracing.Start(ctx, "storage.GetFile", attribute.String("path", path))
+	file, err := s.Storage.GetFile(ctx, path)
+	return file, finish(span, "get_file", err)
+}
+
+func (s *instrumented) ReplaceFile(ctx context.Context, path string) (*File, error) {
+	ctx, span := tracing.Start(ctx, "storage.ReplaceFile", attribute.String("path", path))
+	file, err := s.Storage.ReplaceFile(ctx, path)
+	return file, finish(span, "replace_file", err)
+}
+
+func (s *instrumented) Delete(ctx context.Context, path string) error {
+	ctx, span := tracing.Start(ctx, "storage.Delete", attribute.String("path", path))
+	return finish(span, "delete", s.Storage.Delete(ctx, path))
+}
+
+func (s *instrumented) Copy(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error) {
+	ctx, span := tracing.Start(ctx, "storage.Copy", attribute.String("src", src), attribute.String("dest", dest), attribute.String("on_conflict", string(onConflict)))
+	placement, err := s.Storage.Copy(ctx, dest, src, onConflict)
+	return placement, finish(span, "copy", err)
+}
+
+func (s *instrumented) Move(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error) {
+	ctx, span := tracing.Start(ctx, "storage.Move", attribute.String("src", src), attribute.String("dest", dest), attribute.String("on_conflict", string(onConflict)))
+	placement, err := s.Storage.Move(ctx, dest, src, onConflict)
+	return placement, finish(span, "move", err)
+}
+
+func (s *instrumented) List(ctx context.Context, path string) (*[]DirEntry, error) {
+	ctx, span := tracing.Start(ctx, "storage.List", attribute.String("path", path))
+	entries, err := s.Storage.List(ctx, path)
+	return entries, finish(span, "list", err)
+}
+
+func (s *instrumented) Stat(ctx context.Context, path string) (*DirEntry, error) {
+	ctx, span := tracing.Start(ctx, "storage.Stat", attribute.String("path", path))
+	entry, err := s.Storage.Stat(ctx, path)
+	return entry, finish(span, "stat", err)
+}
+
+func (s *instrumented) Extract(ctx context.Context, dest string, src string, onConflict Conflict) error {
+	ctx, span := tracing.Start(ctx, "storage.Extract", attribute.String("src", src), attribute.String("dest", dest), attribute.String("on_conflict", string(onConflict)))
+	return finish(span, "extract", s.Storage.Extract(ctx, dest, src, onConflict))
+}
+
+func (s *instrumented) Archive(ctx context.Context, dest string, src string) error {
+	ctx, span := tracing.Start(ctx, "storage.Archive", attribute.String("src", src), attribute.String("dest", dest))
+	return finish(span, "archive", s.Storage.Archive(ctx, dest, src))
+}
+
+func (s *instrumented) Changes(ctx context.Context, prefix string, cursor string, limit int) (*ChangeSet, error) {
+	ctx, span := tracing.Start(ctx, "storage.Changes", attribute.String("prefix", prefix), attribute.String("cursor", cursor))
+	changes, err := s.Storage.Changes(ctx, prefix, cursor, limit)
+	return changes, finish(span, "changes", err)
+}
+
+var (
+	filesDesc       = prometheus.NewDesc("go_drive_storage_files", "Number of stored files.", nil, nil)
+	directoriesDesc = prometheus.NewDesc("go_drive_storage_directories", "Number of stored directories.", nil, nil)
+	bytesDesc       = prometheus.NewDesc("go_drive_storage_bytes", "Total size of stored files.", nil, nil)
+	storedBytesDesc = prometheus.NewDesc("go_drive_storage_stored_bytes", "Total size of stored files on disk after compression.", nil, nil)
+)
+
+// StatsCollector exports storage usage, long operations holding the lock
+// don't block scrapes, the last known stats are reported instead
+type StatsCollector struct {
+	st *FileSystem
+}
+
+func NewStatsCollector(st *FileSystem) *StatsCollector {
+	return &StatsCollector{st: st}
+}
+
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- filesDesc
+	ch <- directoriesDesc
+	ch <- bytesDesc
+	ch <- storedBytesDesc
+}
+
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, _ := c.st.cachedStats()
+
+	ch <- prometheus.MustNewConstMetric(filesDesc, prometheus.GaugeValue, float64(stats.Files))
+	ch <- prometheus.MustNewConstMetric(directoriesDesc, prometheus.GaugeValue, float64(stats.Directories))
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.GaugeValue, float64(stats.Bytes))
+	ch <- prometheus.MustNewConstMetric(storedBytesDesc, prometheus.GaugeValue, float64(stats.StoredBytes))
+}
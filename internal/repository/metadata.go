@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+const metadataFile = "metadata.db"
+
+var itemsBucket = []byte("items")
+
+var errCollision = errors.New("name collision")
+
+// itemRecord is FSItem metadata persisted in the index, keyed by storage path
+type itemRecord struct {
+	Type        int         `json:"type"`
+	Size        int64       `json:"size"`
+	Checksum    string      `json:"checksum,omitempty"`
+	ContentType string      `json:"contentType,omitempty"`
+	Encoding    Compression `json:"encoding,omitempty"`
+	Frames      []int64     `json:"frames,omitempty"`
+	Owner       string      `json:"owner,omitempty"`
+	ModTime     time.Time   `json:"modTime"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+func metadataError(err error) error {
+	return &repErr.SystemError{
+		Err:     err,
+		Content: fmt.Sprintf("can't update metadata: %v", err),
+	}
+}
+
+// storagePath returns path of the item as seen by API clients
+func storagePath(item *FSItem) string {
+	return item.Path[len(StorageDirectory):]
+}
+
+func openMetadata() (*bolt.DB, error) {
+	err := os.MkdirAll(DataDirectory, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	return bolt.Open(filepath.Join(DataDirectory, metadataFile), 0644, &bolt.Options{Timeout: time.Second})
+}
+
+func putItem(b *bolt.Bucket, item *FSItem) error {
+	data, err := json.Marshal(itemRecord{
+		Type:        item.Type,
+		Size:        item.Size,
+		Checksum:    item.Checksum,
+		ContentType: item.ContentType,
+		Encoding:    item.Encoding,
+		Frames:      item.Frames,
+		Owner:       item.Owner,
+		ModTime:     item.ModTime,
+		CreatedAt:   item.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(storagePath(item)), data)
+}
+
+// saveItems writes items metadata in a single transaction
+func (st *FileSystem) saveItems(items ...*FSItem) error {
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+		for _, v := range items {
+			if err := putItem(b, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return metadataError(err)
+	}
+
+	return nil
+}
+
+// deleteItem removes metadata of the item and all nested items
+func (st *FileSystem) deleteItem(item *FSItem) error {
+	key := []byte(storagePath(item))
+	prefix := append(key, '/')
+
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+
+		keys := [][]byte{key}
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+
+		for _, v := range keys {
+			if err := b.Delete(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return metadataError(err)
+	}
+
+	return nil
+}
+
+// refresh updates size and modification time of the item from disk and reports whether they changed
+func (st *FileSystem) refresh(item *FSItem) (bool, error) {
+	info, err := os.Stat(item.Path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't stat file: %s: %v", item.Path, err),
+		}
+	}
+
+	if info.Size() == item.diskSize() && info.ModTime().Equal(item.ModTime) {
+		return false, nil
+	}
+
+	if item.Checksum != "" {
+		InvalidateDerived(item.Checksum)
+		item.Checksum = ""
+	}
+
+	// content written over compressed one is plain
+	item.plain()
+	item.Size = info.Size()
+	item.ModTime = info.ModTime()
+	item.ContentType, err = detectContentType(item.content())
+	if err != nil {
+		item.ContentType = ""
+	}
+
+	return true, st.saveItems(item)
+}
+
+// loadTree builds the tree from the index, first start falls back to scanning the disk
+func (st *FileSystem) loadTree() error {
+	empty, collision := false, false
+
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+		if b == nil {
+			empty = true
+			return nil
+		}
+
+		// parent keys are prefixes of child keys so they are always visited first
+		return b.ForEach(func(k, v []byte) error {
+			var rec itemRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+
+			path := fspath.Path(k)
+			dir, err := st.getParentDirectory(path)
+			if err != nil {
+				return err
+			}
+
+			name := path.Base()
+			item := &FSItem{
+				Type:        rec.Type,
+				Path:        dir.Path + "/" + name,
+				Name:        name,
+				Size:        rec.Size,
+				Checksum:    rec.Checksum,
+				ContentType: rec.ContentType,
+				Encoding:    rec.Encoding,
+				Frames:      rec.Frames,
+				Owner:       rec.Owner,
+				ModTime:     rec.ModTime,
+				CreatedAt:   rec.CreatedAt,
+			}
+			if item.Type == fsDir {
+				item.Entry = make(map[string]*FSItem)
+			}
+
+			key := st.naming.key(name)
+			if _, ok := dir.Entry[key]; ok {
+				log.Printf("storage: %s collides with another name under %s naming, rebuilding index", path, st.naming)
+				collision = true
+				return errCollision
+			}
+			dir.Entry[key] = item
+
+			return nil
+		})
+	})
+	if err != nil && !collision {
+		return &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't load metadata: %v", err),
+		}
+	}
+
+	// index written under another name policy is rebuilt, metadata of loaded items is kept
+	if empty || collision {
+		return st.Reconcile()
+	}
+
+	return nil
+}
+
+// Reconcile rescans the storage directory and replaces the index with its content,
+// metadata of unchanged items is kept
+func (st *FileSystem) Reconcile() error {
+	root := &FSItem{
+		Type:  fsDir,
+		Path:  StorageDirectory,
+		Entry: make(map[string]*FSItem),
+	}
+
+	err := st.walkDir(root)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*FSItem, 0)
+	mergeTree(root, st.st, &items)
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Path < items[j].Path
+	})
+
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(itemsBucket) != nil {
+			if err := tx.DeleteBucket(itemsBucket); err != nil {
+				return err
+			}
+		}
+
+		b, err := tx.CreateBucket(itemsBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range items {
+			if err := putItem(b, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return metadataError(err)
+	}
+
+	st.st = root
+
+	return nil
+}
+
+// mergeTree copies metadata from old items to scanned ones and collects all scanned items
+func mergeTree(scanned *FSItem, old *FSItem, items *[]*FSItem) {
+	for name, v := range scanned.Entry {
+		var prev *FSItem
+		if old != nil && old.Entry != nil {
+			prev = old.Entry[name]
+		}
+
+		if prev != nil && prev.Type == v.Type {
+			v.Owner = prev.Owner
+			v.CreatedAt = prev.CreatedAt
+			if v.Size == prev.diskSize() && v.ModTime.Equal(prev.ModTime) {
+				v.inherit(prev)
+				v.ContentType = prev.ContentType
+			}
+		} else {
+			prev = nil
+		}
+
+		*items = append(*items, v)
+
+		if v.Type == fsDir {
+			mergeTree(v, prev, items)
+		}
+	}
+}
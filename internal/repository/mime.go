@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Number of leading bytes used for content type detection
+const sniffLength = 512
+
+const defaultContentType = "application/octet-stream"
+
+// detectContentType recognizes type of the file by its leading bytes,
+// the extension is used when the content looks like generic binary or text
+func detectContentType(c content) (string, error) {
+	file, err := openContent(c)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	sniffed := http.DetectContentType(head[:n])
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(c.path)))
+	if byExt == "" {
+		return sniffed, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(sniffed)
+	switch mediaType {
+	case defaultContentType, "text/plain", "text/xml", "application/zip", "application/x-gzip":
+		// generic types, the extension is more specific, e.g. for SVG, JSON, CSS or DOCX
+		return byExt, nil
+	}
+
+	return sniffed, nil
+}
+
+// ContentType returns detected MIME type of the file, the type is detected and stored on first use
+func (f *File) ContentType() string {
+	if f.item.ContentType == "" {
+		contentType, err := detectContentType(f.item.content())
+		if err != nil {
+			return defaultContentType
+		}
+
+		f.item.ContentType = contentType
+		_ = f.st.saveItems(f.item)
+	}
+
+	return f.item.ContentType
+}
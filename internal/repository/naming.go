@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NamePolicy defines which names of a directory are considered equal
+type NamePolicy string
+
+// Name policies
+const (
+	// CaseSensitive names are equal when they are equal in NFC
+	CaseSensitive NamePolicy = "sensitive"
+	// CaseInsensitive names are compared ignoring case, new names are stored in lower case
+	CaseInsensitive NamePolicy = "insensitive"
+	// CasePreserving names are compared ignoring case, new names are stored as given
+	CasePreserving NamePolicy = "preserving"
+)
+
+// Naming is the name policy of the storage tree, configured on startup
+var Naming = CaseSensitive
+
+// key returns the key of name in FSItem.Entry, names with equal keys collide.
+// Names found on disk may be in any normalization form, so keys are always in NFC
+func (p NamePolicy) key(name string) string {
+	name = norm.NFC.String(name)
+	if p == CaseSensitive {
+		return name
+	}
+
+	return norm.NFC.String(cases.Fold().String(name))
+}
+
+// name returns the form in which a new name is stored
+func (p NamePolicy) name(name string) string {
+	if p != CaseInsensitive {
+		return name
+	}
+
+	return norm.NFC.String(cases.Lower(language.Und).String(name))
+}
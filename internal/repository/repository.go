@@ -1,26 +1,55 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
 	"sort"
-	"strings"
-	"sync"
+	"sync/atomic"
+	"time"
 
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/events"
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/jobs"
+	"github.com/koan6gi/go-drive/internal/metrics"
 	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
 )
 
 type FileSystem struct {
-	mu sync.Mutex
-	st *FSItem
+	// the storage lock, a channel so that waiting for it can be canceled
+	sem           chan struct{}
+	st            *FSItem
+	db            *bolt.DB
+	lock          lockStats
+	openFiles     atomic.Int64
+	stats         cachedStats
+	naming        NamePolicy
+	scrub         scrubState
+	compressQueue chan *FSItem
+	// journalGap is one more than the last journal ID before a change which couldn't be recorded, 0 without gaps.
+	// It's kept in the journal meta and loaded on startup
+	journalGap atomic.Uint64
 }
 
 type FSItem struct {
-	Type  int
-	Path  string
-	Name  string
-	Entry map[string]*FSItem
+	Type        int
+	Path        string
+	Name        string
+	Size        int64
+	Checksum    string
+	ContentType string
+	Encoding    Compression
+	Frames      []int64
+	Owner       string
+	ModTime     time.Time
+	CreatedAt   time.Time
+	Entry       map[string]*FSItem
 }
 
 // FSItem types
@@ -31,9 +60,13 @@ const (
 
 // DirEntry represents file/directory information
 type DirEntry struct {
-	Type string `json:"type"`
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ContentType string    `json:"contentType,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
 }
 
 // DirEntry types
@@ -50,19 +83,34 @@ func (d DirByAlphabet) Less(i, j int) bool {
 	return ((d[i].Type == d[j].Type) && (d[i].Name < d[j].Name)) || (d[i].Type < d[j].Type)
 }
 
-const StorageDirectory = "./storage"
+// Storage locations, configured on startup
+var (
+	StorageDirectory = "./storage"
+	DataDirectory    = "./data"
+)
 
 // TODO: make ext-error types
 type Storage interface {
 	Lock()
+	LockContext(ctx context.Context) error
 	Unlock()
-	CreateFile(path string) (*os.File, error)
-	CreateDirectory(path string) error
-	GetFile(path string) (*os.File, error)
-	Delete(path string) error
-	Copy(dest string, src string) error
-	Move(dest string, src string) error
-	List(path string) (*[]DirEntry, error)
+	Close() error
+	CreateFile(ctx context.Context, path string, onConflict Conflict) (*File, Placement, error)
+	CreateDirectory(ctx context.Context, path string) error
+	GetFile(ctx context.Context, path string) (*File, error)
+	ReplaceFile(ctx context.Context, path string) (*File, error)
+	Delete(ctx context.Context, path string) error
+	Copy(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error)
+	Move(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error)
+	List(ctx context.Context, path string) (*[]DirEntry, error)
+	Stat(ctx context.Context, path string) (*DirEntry, error)
+	// Operations called with Unlocked context take the lock themselves, see Unlocked
+	Extract(ctx context.Context, dest string, src string, onConflict Conflict) error
+	Archive(ctx context.Context, dest string, src string) error
+	Changes(ctx context.Context, prefix string, cursor string, limit int) (*ChangeSet, error)
+	// Ready and Diagnostics don't require the lock
+	Ready() error
+	Diagnostics() Diagnostics
 }
 
 var FileStorage Storage
@@ -75,34 +123,105 @@ func SetupStorage() error {
 
 func NewFileStorage() (*FileSystem, error) {
 	storage := &FileSystem{
-		mu: sync.Mutex{},
+		sem: make(chan struct{}, 1),
 		st: &FSItem{
 			Type:  fsDir,
 			Path:  StorageDirectory,
 			Entry: make(map[string]*FSItem),
 		},
+		naming:        Naming,
+		compressQueue: make(chan *FSItem, compressQueueSize),
 	}
 
-	err := os.Mkdir(StorageDirectory, 0777)
-	if err != nil && !os.IsExist(err) {
+	err := os.MkdirAll(StorageDirectory, 0777)
+	if err != nil {
 		return nil, &repErr.SystemError{
 			Err:     err,
 			Content: fmt.Sprintf("can't create local storage dir: %v", err),
 		}
 	}
 
-	return storage, walkDir(storage.st)
+	removeTemp()
+
+	storage.db, err = openMetadata()
+	if err != nil {
+		return nil, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't open metadata: %v", err),
+		}
+	}
+
+	err = storage.loadTree()
+	if err == nil {
+		err = storage.loadGap()
+	}
+	if err != nil {
+		storage.db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// Close flushes and closes the metadata index
+func (st *FileSystem) Close() error {
+	return st.db.Close()
 }
 
 func (st *FileSystem) Lock() {
-	st.mu.Lock()
+	_ = st.LockContext(context.Background())
+}
+
+// LockContext acquires the lock like Lock, waiting stops with ctx error when ctx is done
+func (st *FileSystem) LockContext(ctx context.Context) error {
+	start := time.Now()
+	st.lock.waiting.Add(1)
+
+	select {
+	case st.sem <- struct{}{}:
+	case <-ctx.Done():
+		st.lock.waiting.Add(-1)
+		return ctx.Err()
+	}
+	st.lock.waiting.Add(-1)
+
+	wait := time.Since(start)
+	st.lock.acquired(wait)
+	metrics.LockWait.Observe(wait.Seconds())
+
+	return nil
 }
 
 func (st *FileSystem) Unlock() {
-	st.mu.Unlock()
+	st.lock.heldSince.Store(0)
+	<-st.sem
+}
+
+type unlockedKey struct{}
+
+// Unlocked marks ctx of a long operation called without the lock, such as a background job.
+// Copy, Move, Extract and Archive called with it take the lock only to read and change the tree,
+// file content is written to staged files without it
+func Unlocked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unlockedKey{}, true)
+}
+
+// locked runs fn holding the lock, it's only taken when the operation was called with Unlocked context
+func (st *FileSystem) locked(ctx context.Context, fn func() error) error {
+	if unlocked, _ := ctx.Value(unlockedKey{}).(bool); !unlocked {
+		return fn()
+	}
+
+	if err := st.LockContext(ctx); err != nil {
+		return err
+	}
+	defer st.Unlock()
+
+	return fn()
 }
 
-func walkDir(d *FSItem) error {
+// walkDir adds content of directory on disk to the tree
+func (st *FileSystem) walkDir(d *FSItem) error {
 	path := d.Path
 	file, err := os.Open(path)
 	if err != nil {
@@ -117,22 +236,32 @@ func walkDir(d *FSItem) error {
 
 	for _, v := range dir {
 		name := v.Name()
-		if name == "." || name == ".." {
+		if name == "." || name == ".." || isTemp(name) {
+			continue
+		}
+
+		key := st.naming.key(name)
+		if prev, ok := d.Entry[key]; ok {
+			log.Printf("storage: %s collides with %s, ignored", path+"/"+name, prev.Path)
 			continue
 		}
 
 		newItem := &FSItem{
-			Type:  fsFile,
-			Path:  path + "/" + name,
-			Name:  name,
-			Entry: nil,
+			Type:      fsFile,
+			Path:      path + "/" + name,
+			Name:      name,
+			Size:      v.Size(),
+			ModTime:   v.ModTime(),
+			CreatedAt: v.ModTime(),
+			Entry:     nil,
 		}
-		d.Entry[name] = newItem
+		d.Entry[key] = newItem
 
 		if v.IsDir() {
 			newItem.Type = fsDir
+			newItem.Size = 0
 			newItem.Entry = make(map[string]*FSItem)
-			err := walkDir(newItem)
+			err := st.walkDir(newItem)
 			if err != nil {
 				return err
 			}
@@ -142,66 +271,130 @@ func walkDir(d *FSItem) error {
 	return nil
 }
 
-func (st *FileSystem) getParentDirectory(path string) (*FSItem, error) {
-	if path == "/" {
-		return st.st, nil
+// parsePath converts path received from a client, rejected paths are reported as PathError
+func parsePath(path string) (fspath.Path, error) {
+	p, err := fspath.Parse(path)
+	if err != nil {
+		return "", &repErr.PathError{
+			Err:     err,
+			Content: err.Error(),
+		}
 	}
 
-	err := &repErr.PathError{
-		Content: fmt.Sprintf("bad path: %s", path),
-	}
+	return p, nil
+}
 
-	paths := strings.Split(path, "/")
-	if len(paths) == 1 {
-		return nil, err
+// checkName validates name of a new file or directory, names of staged files are reserved
+func checkName(path fspath.Path) error {
+	if _, err := fspath.Name(path.Base()); err != nil {
+		return &repErr.PathError{
+			Err:     err,
+			Content: err.Error(),
+		}
 	}
 
-	paths = paths[1 : len(paths)-1]
-	if len(paths) == 0 {
-		return st.st, nil
+	if isTemp(path.Base()) {
+		return &repErr.PathError{
+			Err:     fspath.ErrReservedName,
+			Content: fmt.Sprintf("reserved name: %s", path.Base()),
+		}
 	}
 
-	lastIndex := len(paths) - 1
-
-	dirEntry := st.st
-
-	for i, v := range paths {
-		newEntry, ok := dirEntry.Entry[v]
-		if !ok {
-			break
-		}
+	return nil
+}
 
-		if i == lastIndex && newEntry.Type == fsDir {
-			return newEntry, nil
+func (st *FileSystem) getParentDirectory(path fspath.Path) (*FSItem, error) {
+	dir := st.st
+	for _, v := range path.Dir().Segments() {
+		item, ok := dir.Entry[st.naming.key(v)]
+		if !ok || item.Type != fsDir {
+			return nil, &repErr.PathError{
+				Err:     repErr.ErrNotFound,
+				Content: fmt.Sprintf("bad path: %s", path),
+			}
 		}
-
-		dirEntry = newEntry
+		dir = item
 	}
 
-	return nil, err
+	return dir, nil
 }
 
-func (st *FileSystem) getItem(path string) (*FSItem, error) {
-	if path == "/" {
+func (st *FileSystem) getItem(path fspath.Path) (*FSItem, error) {
+	if path.IsRoot() {
 		return st.st, nil
 	}
 
-	name := path[strings.LastIndex(path, "/")+1:]
 	dir, err := st.getParentDirectory(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if item, ok := dir.Entry[name]; ok {
+	if item, ok := dir.Entry[st.naming.key(path.Base())]; ok {
 		return item, nil
 	}
 
 	return nil, &repErr.PathError{
+		Err:     repErr.ErrNotFound,
 		Content: fmt.Sprintf("bad path: %s", path),
 	}
 }
 
-func (st *FileSystem) GetFile(path string) (*os.File, error) {
+func (st *FileSystem) GetFile(ctx context.Context, path string) (*File, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return st.getFile(ctx, p)
+}
+
+// ReplaceFile opens empty file which replaces content of the existing file at path on Close
+func (st *FileSystem) ReplaceFile(ctx context.Context, path string) (*File, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := st.getItem(p)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type != fsFile {
+		return nil, &repErr.PathError{
+			Content: fmt.Sprintf("not file: %s", path),
+		}
+	}
+
+	file, err := st.stageFile(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	file.event = events.Updated
+	return file, nil
+}
+
+// checkCollision fails when name collides with an item of dir under the name policy
+func (st *FileSystem) checkCollision(dir *FSItem, name string) error {
+	item, ok := dir.Entry[st.naming.key(name)]
+	if !ok {
+		return nil
+	}
+
+	if item.Name == name {
+		return &repErr.PathError{
+			Err:     repErr.ErrExist,
+			Content: fmt.Sprintf("path %s is already exist", storagePath(item)),
+		}
+	}
+
+	return &repErr.PathError{
+		Err:     repErr.ErrExist,
+		Content: fmt.Sprintf("name %s collides with existing %s", name, storagePath(item)),
+	}
+}
+
+func (st *FileSystem) getFile(ctx context.Context, path fspath.Path) (*File, error) {
 	item, err := st.getItem(path)
 	if err != nil {
 		return nil, err
@@ -215,65 +408,260 @@ func (st *FileSystem) GetFile(path string) (*os.File, error) {
 
 	file, err := os.OpenFile(item.Path, os.O_RDWR, 0644)
 	if err != nil {
-		err = &repErr.SystemError{
+		return nil, &repErr.SystemError{
 			Err:     err,
 			Content: fmt.Sprintf("can't open file: %s, %v", item.Path, err),
 		}
 	}
 
-	return file, err
+	st.openFiles.Add(1)
+	f := &File{File: file, st: st, item: item, ctx: ctx, event: events.Updated}
+	if item.Encoding != "" {
+		f.dec = &decoder{file: file, c: item.content()}
+	}
+
+	return f, nil
 }
 
-func (st *FileSystem) CreateFile(path string) (*os.File, error) {
-	name := path[strings.LastIndex(path, "/")+1:]
-	dir, err := st.getParentDirectory(path)
+// CreateFile creates file at path, skipped files are not opened
+func (st *FileSystem) CreateFile(ctx context.Context, path string, onConflict Conflict) (*File, Placement, error) {
+	p, err := parsePath(path)
 	if err != nil {
-		return nil, err
+		return nil, Placement{}, err
 	}
 
-	if _, ok := dir.Entry[name]; ok {
-		return nil, &repErr.PathError{
-			Content: fmt.Sprintf("path %s is already exist", path),
+	file, placement, err := st.createFile(ctx, p, onConflict)
+	if err != nil || file == nil {
+		return nil, placement, err
+	}
+
+	file.event = events.Created
+	if placement.Overwritten {
+		file.event = events.Updated
+	}
+
+	return file, placement, nil
+}
+
+// createFile creates file or stages content of overwritten one without publishing events
+func (st *FileSystem) createFile(ctx context.Context, path fspath.Path, onConflict Conflict) (*File, Placement, error) {
+	if err := checkName(path); err != nil {
+		return nil, Placement{}, err
+	}
+
+	path, existing, err := st.resolveFile(path, onConflict)
+	if err != nil {
+		return nil, Placement{}, err
+	}
+
+	placement := Placement{Path: path.String()}
+	if existing != nil {
+		if onConflict == ConflictSkip {
+			placement.Skipped = true
+			return nil, placement, nil
 		}
+		if transactionFromContext(ctx) != nil {
+			return nil, Placement{}, &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite %s in transaction", path),
+			}
+		}
+
+		file, err := st.stageFile(ctx, existing)
+		if err != nil {
+			return nil, Placement{}, err
+		}
+
+		placement.Overwritten = true
+		return file, placement, nil
+	}
+
+	name := st.naming.name(path.Base())
+	dir, err := st.getParentDirectory(path)
+	if err != nil {
+		return nil, Placement{}, err
 	}
 
 	newFile := &FSItem{
 		Type:  fsFile,
 		Name:  name,
 		Path:  dir.Path + "/" + name,
+		Owner: auth.UserFromContext(ctx),
 		Entry: nil,
 	}
 
 	file, err := os.Create(newFile.Path)
+	if err != nil {
+		return nil, Placement{}, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't create file: %s: %v", newFile.Path, err),
+		}
+	}
+
+	now := time.Now()
+	newFile.ModTime = now
+	newFile.CreatedAt = now
+
+	err = st.saveItems(newFile)
+	if err != nil {
+		file.Close()
+		_ = os.Remove(newFile.Path)
+		return nil, Placement{}, err
+	}
+
+	dir.Entry[st.naming.key(name)] = newFile
+
+	st.openFiles.Add(1)
+	return &File{File: file, st: st, item: newFile, ctx: ctx, hash: NewHash()}, placement, nil
+}
+
+// stageFile opens empty staged file which replaces content of the existing file on Close,
+// the stored file stays unchanged until then
+func (st *FileSystem) stageFile(ctx context.Context, existing *FSItem) (*File, error) {
+	file, err := openStaged(filepath.Dir(existing.Path))
 	if err != nil {
 		return nil, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't overwrite file: %s: %v", existing.Path, err),
+		}
+	}
+
+	st.openFiles.Add(1)
+	return &File{File: file, st: st, item: existing, ctx: ctx, hash: NewHash(), staged: true}, nil
+}
+
+// replace renames staged content over the existing file without publishing events
+func (st *FileSystem) replace(existing *FSItem, staged string, checksum string) error {
+	err := os.Rename(staged, existing.Path)
+	if err != nil {
+		return &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't overwrite file: %s: %v", existing.Path, err),
+		}
+	}
+
+	existing.plain()
+	_, err = st.refresh(existing)
+	if err == nil {
+		err = st.setChecksum(existing, checksum)
+	}
+	if err != nil {
+		return err
+	}
+	st.compress(existing)
+
+	return nil
+}
+
+// install places closed staged file at path resolving conflicts like createFile without publishing
+// events, the staged file is removed when it isn't installed
+func (st *FileSystem) install(ctx context.Context, staged *stagedFile, path fspath.Path, onConflict Conflict) (*FSItem, Placement, error) {
+	item, placement, err := st.placeStaged(ctx, staged, path, onConflict)
+	if err != nil || placement.Skipped {
+		_ = os.Remove(staged.Name())
+	}
+
+	return item, placement, err
+}
+
+func (st *FileSystem) placeStaged(ctx context.Context, staged *stagedFile, path fspath.Path, onConflict Conflict) (*FSItem, Placement, error) {
+	if err := checkName(path); err != nil {
+		return nil, Placement{}, err
+	}
+
+	path, existing, err := st.resolveFile(path, onConflict)
+	if err != nil {
+		return nil, Placement{}, err
+	}
+
+	placement := Placement{Path: path.String()}
+	if existing != nil {
+		if onConflict == ConflictSkip {
+			placement.Skipped = true
+			return nil, placement, nil
+		}
+		if transactionFromContext(ctx) != nil {
+			return nil, Placement{}, &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite %s in transaction", path),
+			}
+		}
+
+		if err := st.replace(existing, staged.Name(), staged.checksum()); err != nil {
+			return nil, Placement{}, err
+		}
+
+		placement.Overwritten = true
+		return existing, placement, nil
+	}
+
+	name := st.naming.name(path.Base())
+	dir, err := st.getParentDirectory(path)
+	if err != nil {
+		return nil, Placement{}, err
+	}
+
+	newFile := &FSItem{
+		Type:      fsFile,
+		Name:      name,
+		Path:      dir.Path + "/" + name,
+		Owner:     auth.UserFromContext(ctx),
+		CreatedAt: time.Now(),
+		Entry:     nil,
+	}
+
+	err = os.Rename(staged.Name(), newFile.Path)
+	if err != nil {
+		return nil, Placement{}, &repErr.SystemError{
 			Err:     err,
 			Content: fmt.Sprintf("can't create file: %s: %v", newFile.Path, err),
 		}
 	}
 
-	dir.Entry[name] = newFile
+	_, err = st.refresh(newFile)
+	if err == nil {
+		err = st.setChecksum(newFile, staged.checksum())
+	}
+	if err != nil {
+		_ = os.Remove(newFile.Path)
+		_ = st.deleteItem(newFile)
+		return nil, Placement{}, err
+	}
 
-	return file, nil
+	dir.Entry[st.naming.key(name)] = newFile
+	st.created(ctx, path)
+	st.compress(newFile)
+
+	return newFile, placement, nil
+}
+
+func (st *FileSystem) CreateDirectory(ctx context.Context, path string) error {
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	return st.createDirectory(ctx, p)
 }
 
-func (st *FileSystem) CreateDirectory(path string) error {
-	name := path[strings.LastIndex(path, "/")+1:]
+func (st *FileSystem) createDirectory(ctx context.Context, path fspath.Path) error {
+	if err := checkName(path); err != nil {
+		return err
+	}
+
+	name := st.naming.name(path.Base())
 	dir, err := st.getParentDirectory(path)
 	if err != nil {
 		return err
 	}
 
-	if _, ok := dir.Entry[name]; ok {
-		return &repErr.PathError{
-			Content: fmt.Sprintf("path %s is already exist", path),
-		}
+	if err := st.checkCollision(dir, name); err != nil {
+		return err
 	}
 
 	newDir := &FSItem{
 		Type:  fsDir,
 		Name:  name,
 		Path:  dir.Path + "/" + name,
+		Owner: auth.UserFromContext(ctx),
 		Entry: make(map[string]*FSItem),
 	}
 
@@ -285,27 +673,55 @@ func (st *FileSystem) CreateDirectory(path string) error {
 		}
 	}
 
-	dir.Entry[name] = newDir
+	now := time.Now()
+	newDir.ModTime = now
+	newDir.CreatedAt = now
+
+	err = st.saveItems(newDir)
+	if err != nil {
+		_ = os.Remove(newDir.Path)
+		return err
+	}
+
+	dir.Entry[st.naming.key(name)] = newDir
+	st.created(ctx, fspath.Path(storagePath(newDir)))
+
+	st.publish(ctx, events.Created, newDir, "")
 
 	return nil
 }
 
-func (st *FileSystem) Delete(path string) error {
-	if path == "/" {
-		return &repErr.PathError{
+func (st *FileSystem) Delete(ctx context.Context, path string) error {
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	item, err := st.discard(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	st.publish(ctx, events.Deleted, item, "")
+
+	return nil
+}
+
+// remove removes file or directory without publishing events
+func (st *FileSystem) remove(path fspath.Path) (*FSItem, error) {
+	if path.IsRoot() {
+		return nil, &repErr.PathError{
 			Content: "can't delete root",
 		}
 	}
 
 	item, err := st.getItem(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	dir, _ := st.getParentDirectory(path)
-	delete(dir.Entry, item.Name)
-
-	err = nil
 
+	// the item stays in the tree when it can't be deleted from disk
 	switch item.Type {
 	case fsFile:
 		err = os.Remove(item.Path)
@@ -314,86 +730,363 @@ func (st *FileSystem) Delete(path string) error {
 	}
 
 	if err != nil {
-		err = &repErr.SystemError{
+		return nil, &repErr.SystemError{
 			Err:     err,
 			Content: fmt.Sprintf("can't delete file or directory: %s: %v", item.Path, err),
 		}
 	}
+	delete(dir.Entry, st.naming.key(item.Name))
+	invalidate(item)
 
-	return err
+	return item, st.deleteItem(item)
 }
 
-func (st *FileSystem) Move(dest string, src string) error {
-	err := st.Copy(dest, src)
+// Move moves file src into directory dest, skipped files stay at src
+func (st *FileSystem) Move(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error) {
+	destPath, srcPath, err := parsePaths(dest, src)
 	if err != nil {
-		return err
+		return Placement{}, err
 	}
 
-	//name := src[strings.LastIndex(src, "/")+1:]
-	//newPath := dest+"/"+name
+	var placement Placement
+	err = st.locked(ctx, func() error {
+		item, err := st.getItem(srcPath)
+		if err != nil {
+			return err
+		}
+		if item.Type != fsFile {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("not file: %s", srcPath),
+			}
+		}
+
+		var moved *FSItem
+		moved, placement, err = st.rename(ctx, srcPath, destPath.Join(item.Name), onConflict)
+		if err != nil || placement.Skipped {
+			return err
+		}
 
-	err = st.Delete(src)
+		st.publish(ctx, events.Moved, moved, srcPath.String())
+		return nil
+	})
 	if err != nil {
-		return err // TODO: return storage to normal stage
+		return Placement{}, err
 	}
 
-	return nil
+	placement.report(ctx)
+	return placement, nil
 }
 
-func (st *FileSystem) Copy(dest string, src string) error {
-	srcFile, err := st.GetFile(src)
+// rename moves file src to target with a single rename on disk, so a failed move leaves src in place.
+// The item keeps its metadata and derived data, an overwritten file is dropped with its own
+func (st *FileSystem) rename(ctx context.Context, src fspath.Path, target fspath.Path, onConflict Conflict) (*FSItem, Placement, error) {
+	item, err := st.getItem(src)
 	if err != nil {
-		return err
+		return nil, Placement{}, err
+	}
+	if err := checkName(target); err != nil {
+		return nil, Placement{}, err
+	}
+
+	target, existing, err := st.resolveFile(target, onConflict)
+	if err != nil {
+		return nil, Placement{}, err
 	}
-	defer srcFile.Close()
 
-	name := src[strings.LastIndex(src, "/")+1:]
-	newPath := dest + "/" + name
+	placement := Placement{Path: target.String()}
+	if existing != nil {
+		if onConflict == ConflictSkip {
+			placement.Skipped = true
+			return nil, placement, nil
+		}
+		if existing == item {
+			return nil, Placement{}, &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite %s with itself", src),
+			}
+		}
+		if transactionFromContext(ctx) != nil {
+			return nil, Placement{}, &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite %s in transaction", target),
+			}
+		}
+		placement.Overwritten = true
+	}
 
-	destFile, err := st.CreateFile(newPath)
+	srcDir, _ := st.getParentDirectory(src)
+	destDir, err := st.getParentDirectory(target)
 	if err != nil {
-		return err
+		return nil, Placement{}, err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, srcFile)
-	if err != nil && err != io.EOF {
-		destFile.Close()
-		_ = st.Delete(newPath)
-		return &repErr.SystemError{
+	name := st.naming.name(target.Base())
+	newPath := destDir.Path + "/" + name
+
+	err = os.Rename(item.Path, newPath)
+	if err != nil {
+		return nil, Placement{}, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't move %s to %s: %v", src, target, err),
+		}
+	}
+
+	old := *item
+	delete(srcDir.Entry, st.naming.key(item.Name))
+	if existing != nil {
+		invalidate(existing)
+	}
+	item.Name, item.Path = name, newPath
+	destDir.Entry[st.naming.key(name)] = item
+
+	if tx := transactionFromContext(ctx); tx != nil {
+		tx.undo = append(tx.undo, func() error {
+			_, _, err := st.rename(context.Background(), target, src, ConflictFail)
+			return err
+		})
+	}
+
+	err = st.deleteItem(&old)
+	if err == nil && existing != nil {
+		err = st.deleteItem(existing)
+	}
+	if err == nil {
+		err = st.saveItems(item)
+	}
+	if err != nil {
+		return nil, Placement{}, err
+	}
+
+	return item, placement, nil
+}
+
+// Copy copies file src into directory dest
+func (st *FileSystem) Copy(ctx context.Context, dest string, src string, onConflict Conflict) (Placement, error) {
+	destPath, srcPath, err := parsePaths(dest, src)
+	if err != nil {
+		return Placement{}, err
+	}
+
+	return st.copy(ctx, destPath, srcPath, onConflict)
+}
+
+func parsePaths(dest string, src string) (fspath.Path, fspath.Path, error) {
+	destPath, err := parsePath(dest)
+	if err != nil {
+		return "", "", err
+	}
+
+	srcPath, err := parsePath(src)
+	if err != nil {
+		return "", "", err
+	}
+
+	return destPath, srcPath, nil
+}
+
+// copy copies file src into directory dest, content is staged without the lock for Unlocked context
+// and the copy fails when src changes meanwhile
+func (st *FileSystem) copy(ctx context.Context, dest fspath.Path, src fspath.Path, onConflict Conflict) (Placement, error) {
+	var (
+		source    itemSnapshot
+		newPath   fspath.Path
+		dir       string
+		placement Placement
+	)
+
+	err := st.locked(ctx, func() error {
+		item, err := st.getItem(src)
+		if err != nil {
+			return err
+		}
+		if item.Type != fsFile {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("not file: %s", src),
+			}
+		}
+
+		newPath = dest.Join(item.Name)
+		if err := checkName(newPath); err != nil {
+			return err
+		}
+
+		// conflicts are resolved again on install, here they only fail the copy before content is read
+		_, existing, err := st.resolveFile(newPath, onConflict)
+		if err != nil {
+			return err
+		}
+		if existing == item && onConflict == ConflictOverwrite {
+			return &repErr.PathError{
+				Content: fmt.Sprintf("can't overwrite %s with itself", src),
+			}
+		}
+		if existing != nil && onConflict == ConflictSkip {
+			placement = Placement{Path: storagePath(existing), Skipped: true}
+			return nil
+		}
+
+		parent, err := st.getParentDirectory(newPath)
+		if err != nil {
+			return err
+		}
+
+		source, dir = snapshotOf(item), parent.Path
+		return nil
+	})
+	if err != nil {
+		return Placement{}, err
+	}
+	if placement.Skipped {
+		placement.report(ctx)
+		return placement, nil
+	}
+
+	staged, err := stageContent(ctx, dir, source.content)
+	if err != nil {
+		return Placement{}, &repErr.SystemError{
 			Err:     err,
 			Content: fmt.Sprintf("can't copy %s to %s: %v", src, dest, err),
 		}
 	}
 
-	return nil
+	err = st.locked(ctx, func() error {
+		if !st.current(source) {
+			_ = os.Remove(staged.Name())
+			return &repErr.PathError{
+				Err:     repErr.ErrChanged,
+				Content: fmt.Sprintf("%s was changed while copying", src),
+			}
+		}
+
+		var item *FSItem
+		item, placement, err = st.install(ctx, staged, newPath, onConflict)
+		if err != nil || placement.Skipped {
+			return err
+		}
+
+		st.publish(ctx, events.Copied, item, src.String())
+		return nil
+	})
+	if err != nil {
+		return Placement{}, err
+	}
+
+	placement.report(ctx)
+	return placement, nil
 }
 
-func (st *FileSystem) List(path string) (*[]DirEntry, error) {
-	item, err := st.getItem(path)
+// stageContent copies plain content of a stored file into a closed staged file in dir
+func stageContent(ctx context.Context, dir string, c content) (*stagedFile, error) {
+	src, err := openContent(c)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	staged, err := createStaged(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = copyContext(ctx, staged, src)
+	if err == nil {
+		err = staged.Close()
+	}
+	if err != nil {
+		staged.discard()
+		return nil, err
+	}
+
+	return staged, nil
+}
+
+// copyContext copies src to dst reporting job progress and stopping when ctx is done
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	var written int64
+	buf := make([]byte, 32*1024)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			jobs.AddProgress(ctx, int64(m), 0)
+			if werr != nil {
+				return written, werr
+			}
+		}
+
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func (st *FileSystem) List(ctx context.Context, path string) (*[]DirEntry, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := st.getItem(p)
 	if err != nil {
 		return nil, err
 	}
 	if item.Type != fsDir {
-		return nil, fmt.Errorf("%s hot directory", path)
+		return nil, &repErr.PathError{
+			Content: fmt.Sprintf("not directory: %s", path),
+		}
 	}
 
 	result := make([]DirEntry, 0)
 
 	for _, v := range item.Entry {
-		itemType := deFile
-		if v.Type == fsDir {
-			itemType = deDir
-		}
-
-		result = append(result, DirEntry{
-			Name: v.Name,
-			Path: v.Path[len(StorageDirectory):],
-			Type: itemType,
-		})
+		result = append(result, dirEntry(v))
 	}
 
 	sort.Sort(DirByAlphabet(result))
 
 	return &result, nil
 }
+
+// Stat returns information about file or directory, missing items are reported as PathError with ErrNotFound
+func (st *FileSystem) Stat(ctx context.Context, path string) (*DirEntry, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := st.getItem(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := dirEntry(item)
+	if p.IsRoot() {
+		entry.Path = fspath.Root.String()
+	}
+
+	return &entry, nil
+}
+
+func dirEntry(v *FSItem) DirEntry {
+	itemType := deFile
+	if v.Type == fsDir {
+		itemType = deDir
+	}
+
+	return DirEntry{
+		Name:        v.Name,
+		Path:        storagePath(v),
+		Type:        itemType,
+		Size:        v.Size,
+		ModTime:     v.ModTime,
+		ContentType: v.ContentType,
+		Checksum:    v.Checksum,
+	}
+}
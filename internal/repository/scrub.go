@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+	"github.com/koan6gi/go-drive/internal/metrics"
+)
+
+// Number of mismatches kept in the scrub report
+const maxScrubMismatches = 1000
+
+// ScrubMismatch is a stored file whose content doesn't match its checksum or can't be read
+type ScrubMismatch struct {
+	Path     string    `json:"path"`
+	Expected string    `json:"expected"`
+	Actual   string    `json:"actual,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ScrubReport describes the current or the last integrity check of stored files,
+// files changed during the check are skipped
+type ScrubReport struct {
+	Running    bool            `json:"running"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Files      int64           `json:"files"`
+	Bytes      int64           `json:"bytes"`
+	Skipped    int64           `json:"skipped"`
+	Mismatches []ScrubMismatch `json:"mismatches"`
+}
+
+type scrubState struct {
+	mu     sync.Mutex
+	report ScrubReport
+}
+
+func (s *scrubState) update(fn func(r *ScrubReport)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.report)
+}
+
+// snapshot returns copy of the report
+func (s *scrubState) snapshot() ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.report
+	r.Mismatches = append([]ScrubMismatch{}, r.Mismatches...)
+	return r
+}
+
+// itemSnapshot is a file with its metadata at the moment work on it without the lock was planned
+type itemSnapshot struct {
+	item     *FSItem
+	content  content
+	modTime  time.Time
+	checksum string
+}
+
+func snapshotOf(item *FSItem) itemSnapshot {
+	return itemSnapshot{item: item, content: item.content(), modTime: item.ModTime, checksum: item.Checksum}
+}
+
+// Scrub re-hashes all stored files every interval until ctx is done, mismatches are logged
+// and reported in Diagnostics. Files without checksum get one
+func (st *FileSystem) Scrub(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			st.scrubOnce(ctx)
+		}
+	}
+}
+
+func (st *FileSystem) scrubOnce(ctx context.Context) {
+	st.scrub.update(func(r *ScrubReport) {
+		*r = ScrubReport{Running: true, StartedAt: time.Now(), Mismatches: make([]ScrubMismatch, 0)}
+	})
+	defer st.scrub.update(func(r *ScrubReport) {
+		r.Running = false
+		r.FinishedAt = time.Now()
+	})
+
+	st.Lock()
+	targets := make([]itemSnapshot, 0)
+	var collect func(item *FSItem)
+	collect = func(item *FSItem) {
+		for _, v := range item.Entry {
+			if v.Type == fsDir {
+				collect(v)
+				continue
+			}
+			targets = append(targets, snapshotOf(v))
+		}
+	}
+	collect(st.st)
+	st.Unlock()
+
+	for _, v := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// files are hashed without the lock, so the result is only used when nothing has changed meanwhile
+		actual, err := hashFile(ctx, v.content)
+		if ctx.Err() != nil {
+			return
+		}
+
+		st.Lock()
+		ok := st.unchanged(v)
+		if ok && err == nil && v.checksum == "" {
+			v.item.Checksum = actual
+			if err := st.saveItems(v.item); err != nil {
+				log.Printf("scrubber: %v", err)
+			}
+		}
+		st.Unlock()
+
+		if !ok {
+			st.scrub.update(func(r *ScrubReport) { r.Skipped++ })
+			continue
+		}
+
+		metrics.ScrubbedBytes.Add(float64(v.content.size))
+		st.scrub.update(func(r *ScrubReport) {
+			r.Files++
+			r.Bytes += v.content.size
+		})
+
+		// unreadable content, e.g. corrupted compressed data, is reported as a mismatch
+		if err != nil || (v.checksum != "" && actual != v.checksum) {
+			mismatch := ScrubMismatch{Path: storagePath(v.item), Expected: v.checksum, Actual: actual, Time: time.Now()}
+			if err != nil {
+				mismatch.Error = err.Error()
+				log.Printf("scrubber: can't read %s: %v", mismatch.Path, err)
+			} else {
+				log.Printf("scrubber: checksum mismatch: %s: expected %s, got %s", mismatch.Path, v.checksum, actual)
+			}
+
+			metrics.ScrubMismatches.Inc()
+			st.scrub.update(func(r *ScrubReport) {
+				if len(r.Mismatches) < maxScrubMismatches {
+					r.Mismatches = append(r.Mismatches, mismatch)
+				}
+			})
+		}
+	}
+}
+
+// current reports whether the file is still in the tree with the same metadata, caller must hold the lock
+func (st *FileSystem) current(v itemSnapshot) bool {
+	item, err := st.getItem(fspath.Path(storagePath(v.item)))
+	if err != nil || item != v.item {
+		return false
+	}
+
+	return item.Size == v.content.size && item.Encoding == v.content.encoding && item.ModTime.Equal(v.modTime) && item.Checksum == v.checksum
+}
+
+// unchanged reports whether the file is current and the file on disk wasn't modified, caller must hold the lock
+func (st *FileSystem) unchanged(v itemSnapshot) bool {
+	if !st.current(v) {
+		return false
+	}
+
+	item := v.item
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return false
+	}
+
+	// content changed outside of the API is picked up by the watcher
+	return info.Size() == item.diskSize() && info.ModTime().Equal(v.modTime)
+}
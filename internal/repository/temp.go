@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Files staged by the storage, e.g. deleted in transactions or being compressed, are kept
+// next to their targets under hidden names with this prefix. They are never part of the tree
+// and leftovers of a crash are removed on startup
+const tempPrefix = ".go-drive-"
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), tempPrefix)
+}
+
+// tempPath returns a random path of a staged file in dir
+func tempPath(dir string, kind string) string {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+
+	return filepath.Join(dir, tempPrefix+kind+"-"+hex.EncodeToString(suffix))
+}
+
+// removeTemp removes staged files left in the storage directory
+func removeTemp() {
+	err := filepath.WalkDir(StorageDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !isTemp(d.Name()) {
+			return err
+		}
+
+		log.Printf("storage: removing leftover %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("storage: %v", err)
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("storage: can't remove leftovers: %v", err)
+	}
+}
+
+// stagedFile is new content written next to its target without the lock, it's placed into the tree
+// by install after it's closed
+type stagedFile struct {
+	*os.File
+	hash hash.Hash
+}
+
+// openStaged creates empty staged file in the directory on disk
+func openStaged(dir string) (*os.File, error) {
+	return os.OpenFile(tempPath(dir, "stage"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// createStaged creates staged file in the directory on disk
+func createStaged(dir string) (*stagedFile, error) {
+	file, err := openStaged(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stagedFile{File: file, hash: NewHash()}, nil
+}
+
+func (f *stagedFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.hash.Write(p[:n])
+	return n, err
+}
+
+// ReadFrom hides os.File.ReadFrom, so io.Copy writes through Write
+func (f *stagedFile) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+func (f *stagedFile) checksum() string {
+	return hex.EncodeToString(f.hash.Sum(nil))
+}
+
+// discard closes and removes the staged file
+func (f *stagedFile) discard() {
+	f.File.Close()
+	_ = os.Remove(f.Name())
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/koan6gi/go-drive/internal/fspath"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Transaction makes changes done with its context revertible until Commit or Rollback.
+// Deleted items are kept on disk under hidden names, moved files are renamed back and events are held back,
+// overwriting files is not supported. The storage lock must be held until the transaction ends
+type Transaction struct {
+	undo   []func() error
+	commit []func() error
+	events []func()
+}
+
+type transactionKey struct{}
+
+// WithTransaction starts a transaction used by storage operations called with the returned context
+func WithTransaction(ctx context.Context) (context.Context, *Transaction) {
+	tx := &Transaction{}
+	return context.WithValue(ctx, transactionKey{}, tx), tx
+}
+
+func transactionFromContext(ctx context.Context) *Transaction {
+	tx, _ := ctx.Value(transactionKey{}).(*Transaction)
+	return tx
+}
+
+// Commit removes staged items and publishes held back events
+func (tx *Transaction) Commit() {
+	for _, v := range tx.commit {
+		if err := v(); err != nil {
+			log.Printf("transaction: %v", err)
+		}
+	}
+
+	for _, v := range tx.events {
+		v()
+	}
+
+	*tx = Transaction{}
+}
+
+// Rollback reverts changes in reverse order, held back events are dropped
+func (tx *Transaction) Rollback() error {
+	var errs []error
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	*tx = Transaction{}
+
+	return errors.Join(errs...)
+}
+
+// discard removes item, inside a transaction the item is staged and its derived data kept until commit
+func (st *FileSystem) discard(ctx context.Context, path fspath.Path) (*FSItem, error) {
+	tx := transactionFromContext(ctx)
+	if tx == nil {
+		return st.remove(path)
+	}
+
+	if path.IsRoot() {
+		return nil, &repErr.PathError{
+			Content: "can't delete root",
+		}
+	}
+
+	item, err := st.getItem(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, _ := st.getParentDirectory(path)
+
+	staged := tempPath(filepath.Dir(item.Path), "tx")
+
+	err = os.Rename(item.Path, staged)
+	if err != nil {
+		return nil, &repErr.SystemError{
+			Err:     err,
+			Content: fmt.Sprintf("can't delete file or directory: %s: %v", item.Path, err),
+		}
+	}
+
+	items := make([]*FSItem, 0)
+	collectItems(item, &items)
+
+	key := st.naming.key(item.Name)
+	delete(dir.Entry, key)
+
+	tx.undo = append(tx.undo, func() error {
+		if err := os.Rename(staged, item.Path); err != nil {
+			return fmt.Errorf("can't restore %s: %w", item.Path, err)
+		}
+		dir.Entry[key] = item
+		return st.saveItems(items...)
+	})
+	tx.commit = append(tx.commit, func() error {
+		invalidate(item)
+		return os.RemoveAll(staged)
+	})
+
+	return item, st.deleteItem(item)
+}
+
+// created registers removal of a new item on rollback
+func (st *FileSystem) created(ctx context.Context, path fspath.Path) {
+	if tx := transactionFromContext(ctx); tx != nil {
+		tx.undo = append(tx.undo, func() error {
+			_, err := st.remove(path)
+			return err
+		})
+	}
+}
+
+func collectItems(item *FSItem, items *[]*FSItem) {
+	*items = append(*items, item)
+	for _, v := range item.Entry {
+		collectItems(v, items)
+	}
+}
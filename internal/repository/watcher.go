@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/koan6gi/go-drive/internal/events"
+	"github.com/koan6gi/go-drive/internal/fspath"
+)
+
+// Delay before dirty directories are synced, lets bursts of notifications settle
+const watchDebounce = 200 * time.Millisecond
+
+// changes found while syncing the tree with the disk
+type changes struct {
+	added   []*FSItem
+	removed []*FSItem
+	updated []*FSItem
+}
+
+// Watch keeps the tree in sync with changes made to the storage directory
+// bypassing the API, the whole tree is also rescanned every interval
+func (st *FileSystem) Watch(ctx context.Context, interval time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	st.Lock()
+	addWatches(watcher, st.st)
+	st.Unlock()
+
+	root := filepath.Clean(StorageDirectory)
+	dirty := make(map[string]bool)
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	rescan := time.NewTicker(interval)
+	defer rescan.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isTemp(filepath.Base(ev.Name)) {
+				continue
+			}
+			dir := filepath.Dir(filepath.Clean(ev.Name))
+			dirty[strings.TrimPrefix(dir, root)] = true
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("storage watcher: %v", err)
+		case <-debounce.C:
+			st.Lock()
+			ch := &changes{}
+			for path := range dirty {
+				if path == "" {
+					path = "/"
+				}
+				item, err := st.getItem(fspath.Path(filepath.ToSlash(path)))
+				if err != nil || item.Type != fsDir {
+					continue
+				}
+				st.syncDir(item, false, ch)
+			}
+			st.applyChanges(watcher, ch)
+			st.Unlock()
+			dirty = make(map[string]bool)
+		case <-rescan.C:
+			st.Lock()
+			ch := &changes{}
+			st.syncDir(st.st, true, ch)
+			st.applyChanges(watcher, ch)
+			st.Unlock()
+		}
+	}
+}
+
+func addWatches(watcher *fsnotify.Watcher, dir *FSItem) {
+	err := watcher.Add(dir.Path)
+	if err != nil {
+		log.Printf("storage watcher: can't watch %s: %v", dir.Path, err)
+	}
+
+	for _, v := range dir.Entry {
+		if v.Type == fsDir {
+			addWatches(watcher, v)
+		}
+	}
+}
+
+func removeWatches(watcher *fsnotify.Watcher, dir *FSItem) {
+	_ = watcher.Remove(dir.Path)
+
+	for _, v := range dir.Entry {
+		if v.Type == fsDir {
+			removeWatches(watcher, v)
+		}
+	}
+}
+
+// syncDir compares directory with its content on disk and updates the tree
+func (st *FileSystem) syncDir(dir *FSItem, recursive bool, ch *changes) {
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		// removed directory is handled while syncing its parent
+		return
+	}
+
+	seen := make(map[string]bool)
+
+	for _, v := range entries {
+		info, err := v.Info()
+		if err != nil {
+			continue
+		}
+
+		name := v.Name()
+		if isTemp(name) {
+			continue
+		}
+		key := st.naming.key(name)
+		if seen[key] {
+			log.Printf("storage watcher: %s/%s collides with another name, ignored", dir.Path, name)
+			continue
+		}
+		seen[key] = true
+
+		itemType := fsFile
+		if info.IsDir() {
+			itemType = fsDir
+		}
+
+		item, ok := dir.Entry[key]
+		if ok && item.Type == itemType {
+			if itemType == fsDir {
+				if recursive {
+					st.syncDir(item, true, ch)
+				}
+				continue
+			}
+
+			if item.diskSize() != info.Size() || !item.ModTime.Equal(info.ModTime()) {
+				item.plain()
+				item.Size = info.Size()
+				item.ModTime = info.ModTime()
+				if item.Checksum != "" {
+					InvalidateDerived(item.Checksum)
+				}
+				item.Checksum = ""
+				item.ContentType = ""
+				ch.updated = append(ch.updated, item)
+			}
+			continue
+		}
+
+		if ok {
+			ch.removed = append(ch.removed, item)
+		}
+
+		newItem := &FSItem{
+			Type:      itemType,
+			Path:      dir.Path + "/" + name,
+			Name:      name,
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+			CreatedAt: time.Now(),
+		}
+		if itemType == fsDir {
+			newItem.Size = 0
+			newItem.Entry = make(map[string]*FSItem)
+			if err := st.walkDir(newItem); err != nil {
+				log.Printf("storage watcher: %v", err)
+			}
+		}
+
+		dir.Entry[key] = newItem
+		ch.added = append(ch.added, newItem)
+	}
+
+	for key, v := range dir.Entry {
+		if !seen[key] {
+			delete(dir.Entry, key)
+			ch.removed = append(ch.removed, v)
+		}
+	}
+}
+
+// applyChanges persists found changes and publishes events,
+// removed and added items of the same type, size and modification time are treated as renames
+func (st *FileSystem) applyChanges(watcher *fsnotify.Watcher, ch *changes) {
+	moved := make(map[*FSItem]*FSItem)
+
+	for _, removed := range ch.removed {
+		if err := st.deleteItem(removed); err != nil {
+			log.Printf("storage watcher: %v", err)
+		}
+		if removed.Type == fsDir {
+			removeWatches(watcher, removed)
+		}
+
+		for _, added := range ch.added {
+			if _, ok := moved[added]; ok {
+				continue
+			}
+			if added.Type == removed.Type && added.Size == removed.diskSize() && added.ModTime.Equal(removed.ModTime) {
+				moved[added] = removed
+				break
+			}
+		}
+	}
+
+	for _, added := range ch.added {
+		items := []*FSItem{added}
+		mergeTree(added, moved[added], &items)
+
+		if old, ok := moved[added]; ok {
+			added.Owner = old.Owner
+			added.CreatedAt = old.CreatedAt
+			if added.Type == fsFile {
+				added.inherit(old)
+			}
+		}
+
+		if err := st.saveItems(items...); err != nil {
+			log.Printf("storage watcher: %v", err)
+		}
+
+		if added.Type == fsDir {
+			addWatches(watcher, added)
+		}
+	}
+
+	if len(ch.updated) > 0 {
+		if err := st.saveItems(ch.updated...); err != nil {
+			log.Printf("storage watcher: %v", err)
+		}
+	}
+
+	for _, v := range ch.removed {
+		if !isMoved(moved, v) {
+			invalidate(v)
+			st.publishExternal(events.Deleted, v, "")
+		}
+	}
+	for _, v := range ch.added {
+		if old, ok := moved[v]; ok {
+			st.publishExternal(events.Moved, v, storagePath(old))
+		} else {
+			st.publishExternal(events.Created, v, "")
+		}
+	}
+	for _, v := range ch.updated {
+		st.publishExternal(events.Updated, v, "")
+	}
+}
+
+func isMoved(moved map[*FSItem]*FSItem, item *FSItem) bool {
+	for _, v := range moved {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
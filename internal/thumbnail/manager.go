@@ -0,0 +1,210 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/events"
+	"github.com/koan6gi/go-drive/internal/repository"
+	repErr "github.com/koan6gi/go-drive/internal/repository/errors"
+)
+
+// Number of uploaded images waiting for pregeneration
+const queueSize = 1024
+
+// Thumbnail is a generated thumbnail file, Checksum is the checksum of the source content
+type Thumbnail struct {
+	Path        string
+	ContentType string
+	Checksum    string
+	format      format
+}
+
+// Manager keeps thumbnails in a cache directory keyed by content checksum,
+// so renamed and copied images share their thumbnails
+type Manager struct {
+	dir   string
+	queue chan string
+}
+
+var Thumbnails *Manager
+
+func NewManager(dir string) (*Manager, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		dir:   dir,
+		queue: make(chan string, queueSize),
+	}, nil
+}
+
+func (m *Manager) path(checksum string, size int, f format) string {
+	return filepath.Join(m.dir, checksum[:2], checksum+"-"+strconv.Itoa(size)+f.ext)
+}
+
+// Get returns thumbnail of the file at p generating it when it's missing. The storage lock must not be held,
+// it's taken to open the file and to store the thumbnail, images are decoded and scaled without it
+func (m *Manager) Get(ctx context.Context, p string, size int) (*Thumbnail, error) {
+	t, content, modTime, err := m.open(ctx, p, size)
+	if err != nil || content == nil {
+		return t, err
+	}
+
+	tmp, err := generate(content, t.Path, size, t.format)
+	content.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	err = m.store(ctx, p, modTime, tmp, t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// open resolves thumbnail of the file holding the lock, content snapshot is returned when the thumbnail is missing
+func (m *Manager) open(ctx context.Context, p string, size int) (*Thumbnail, io.ReadSeekCloser, time.Time, error) {
+	if err := repository.FileStorage.LockContext(ctx); err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	defer repository.FileStorage.Unlock()
+
+	file, err := repository.FileStorage.GetFile(ctx, p)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	contentType, _, _ := mime.ParseMediaType(file.ContentType())
+	if !supportedTypes[contentType] {
+		return nil, nil, time.Time{}, ErrUnsupported
+	}
+
+	checksum, err := file.Checksum()
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	f := formatOf(contentType)
+	t := &Thumbnail{
+		Path:        m.path(checksum, size, f),
+		ContentType: f.contentType,
+		Checksum:    checksum,
+		format:      f,
+	}
+
+	if _, err := os.Stat(t.Path); err == nil {
+		return t, nil, time.Time{}, nil
+	}
+
+	content, err := file.Snapshot()
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	return t, content, file.ModTime(), nil
+}
+
+// store places generated thumbnail into the cache holding the lock when the file wasn't modified since open
+func (m *Manager) store(ctx context.Context, p string, modTime time.Time, tmp string, path string) error {
+	if err := repository.FileStorage.LockContext(ctx); err != nil {
+		return err
+	}
+	defer repository.FileStorage.Unlock()
+
+	file, err := repository.FileStorage.GetFile(ctx, p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if !file.ModTime().Equal(modTime) {
+		return &repErr.PathError{
+			Err:     repErr.ErrChanged,
+			Content: fmt.Sprintf("%s was changed while generating thumbnail", p),
+		}
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Invalidate removes thumbnails of content with the checksum
+func (m *Manager) Invalidate(checksum string) {
+	if len(checksum) < 2 {
+		return
+	}
+
+	files, _ := filepath.Glob(filepath.Join(m.dir, checksum[:2], checksum+"-*"))
+	for _, v := range files {
+		if err := os.Remove(v); err != nil && !os.IsNotExist(err) {
+			log.Printf("thumbnails: %v", err)
+		}
+	}
+}
+
+// Run pregenerates thumbnails of the default size for uploaded, copied and moved images until ctx is done
+func (m *Manager) Run(ctx context.Context, bus *events.Bus, workers int) {
+	unsubscribe := bus.Subscribe(m.enqueue)
+	defer unsubscribe()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case p := <-m.queue:
+					m.pregenerate(ctx, p)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// enqueue schedules pregeneration for files which look like images by name, it never blocks the bus
+func (m *Manager) enqueue(e events.Event) {
+	if e.ItemType != "file" || e.Type == events.Deleted {
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(e.Path)))
+	if !supportedTypes[contentType] {
+		return
+	}
+
+	select {
+	case m.queue <- e.Path:
+	default:
+		log.Printf("thumbnails: queue is full, %s skipped", e.Path)
+	}
+}
+
+func (m *Manager) pregenerate(ctx context.Context, p string) {
+	_, err := m.Get(ctx, p, DefaultSize)
+	// the file can be already gone or changed, the next event schedules it again
+	var pathErr *repErr.PathError
+	if err != nil && !errors.Is(err, ErrUnsupported) && !errors.As(err, &pathErr) && ctx.Err() == nil {
+		log.Printf("thumbnails: %s: %v", p, err)
+	}
+}
@@ -0,0 +1,146 @@
+package thumbnail
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultSize is the size of pregenerated thumbnails, a thumbnail fits into a square with the side of its size
+const DefaultSize = 256
+
+const (
+	// images with more pixels are not decoded to protect memory from decompression bombs
+	maxPixels   = 50_000_000
+	jpegQuality = 85
+)
+
+var sizes = map[int]bool{64: true, 128: true, 256: true, 512: true}
+
+// Content types of images thumbnails are generated for
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	ErrUnsupported = errors.New("unsupported image type")
+	ErrBadImage    = errors.New("can't decode image")
+)
+
+// ParseSize parses thumbnail size, empty string means DefaultSize
+func ParseSize(s string) (int, error) {
+	if s == "" {
+		return DefaultSize, nil
+	}
+
+	size, err := strconv.Atoi(s)
+	if err != nil || !sizes[size] {
+		return 0, fmt.Errorf("unknown thumbnail size %q, expected 64, 128, 256 or 512", s)
+	}
+
+	return size, nil
+}
+
+// format is an encoding of thumbnails, JPEG images stay JPEG and others become PNG to keep transparency
+type format struct {
+	ext         string
+	contentType string
+	encode      func(w io.Writer, img image.Image) error
+}
+
+var (
+	formatJPEG = format{".jpg", "image/jpeg", func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}}
+	formatPNG = format{".png", "image/png", png.Encode}
+)
+
+func formatOf(contentType string) format {
+	if contentType == "image/jpeg" {
+		return formatJPEG
+	}
+	return formatPNG
+}
+
+// decode decodes the first frame of the image checking its dimensions first
+func decode(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d image is larger than %d pixels", ErrBadImage, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadImage, err)
+	}
+
+	return img, nil
+}
+
+// scale fits the image into size x size keeping its aspect ratio, smaller images are not enlarged
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	return dst
+}
+
+// generate writes thumbnail of the image read from r to a temporary file next to path,
+// the caller renames it to path or removes it
+func generate(r io.ReadSeeker, path string, size int, f format) (string, error) {
+	img, err := decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	err = f.encode(tmp, scale(img, size))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
@@ -0,0 +1,518 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koan6gi/go-drive/internal/auth"
+	"github.com/koan6gi/go-drive/internal/events"
+)
+
+// Delivery settings
+const (
+	maxAttempts   = 5
+	firstBackoff  = time.Second
+	maxDeliveries = 100
+	queueSize     = 1024
+	sendTimeout   = 10 * time.Second
+	// recorded deliveries are saved in batches at most this often
+	saveInterval = 5 * time.Second
+)
+
+// Delivery headers, the signature covers the timestamp and the body, see Sign
+const (
+	HeaderEvent     = "X-Go-Drive-Event"
+	HeaderDelivery  = "X-Go-Drive-Delivery"
+	HeaderTimestamp = "X-Go-Drive-Timestamp"
+	HeaderSignature = "X-Go-Drive-Signature"
+)
+
+// ErrAddressNotAllowed is returned for webhooks targeting loopback, link-local, private
+// or other internal addresses outside of allowed networks
+var ErrAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// Carrier-grade NAT addresses are internal as well as private ones
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Hook is a registered webhook receiving events for paths inside Prefix
+type Hook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Prefix    string    `json:"prefix"`
+	Secret    string    `json:"secret,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Delivery is a delivery log record
+type Delivery struct {
+	ID         string    `json:"id"`
+	HookID     string    `json:"hookId"`
+	EventID    uint64    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	Path       string    `json:"path"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	Time       time.Time `json:"time"`
+}
+
+type state struct {
+	Hooks      []*Hook               `json:"hooks"`
+	Deliveries map[string][]Delivery `json:"deliveries"`
+}
+
+type task struct {
+	hook  Hook
+	event events.Event
+}
+
+type Manager struct {
+	mu         sync.Mutex
+	hooks      map[string]*Hook
+	deliveries map[string][]Delivery
+	// dirty is set when deliveries were recorded after the last save
+	dirty bool
+	// saveMu orders writes of the state file, they are done without mu
+	saveMu    sync.Mutex
+	stateFile string
+	events    chan events.Event
+	queue     chan task
+	allowed   []netip.Prefix
+	client    *http.Client
+}
+
+var HookManager *Manager
+
+// NewManager loads webhooks from stateFile, deliveries to internal addresses are refused
+// unless they are inside allowed networks
+func NewManager(stateFile string, allowed []netip.Prefix) (*Manager, error) {
+	m := &Manager{
+		mu:         sync.Mutex{},
+		hooks:      make(map[string]*Hook),
+		deliveries: make(map[string][]Delivery),
+		stateFile:  stateFile,
+		events:     make(chan events.Event, queueSize),
+		queue:      make(chan task, queueSize),
+		allowed:    allowed,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: sendTimeout,
+		Control: m.checkDial,
+	}
+	m.client = &http.Client{
+		Timeout: sendTimeout,
+		// addresses are checked when connecting, so a proxy would hide the target
+		Transport: &http.Transport{
+			Proxy:       nil,
+			DialContext: dialer.DialContext,
+		},
+	}
+
+	err := os.MkdirAll(filepath.Dir(stateFile), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved state
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range saved.Hooks {
+		m.hooks[v.ID] = v
+	}
+	if saved.Deliveries != nil {
+		m.deliveries = saved.Deliveries
+	}
+
+	return m, nil
+}
+
+// Register adds webhook, random secret is generated when secret is empty
+func (m *Manager) Register(owner string, hookURL string, prefix string, secret string) (Hook, error) {
+	u, err := url.Parse(hookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Hook{}, fmt.Errorf("bad webhook url: %s", hookURL)
+	}
+	// host names are checked on every delivery after they are resolved
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !m.addressAllowed(addr) {
+		return Hook{}, fmt.Errorf("%w: %s", ErrAddressNotAllowed, hookURL)
+	}
+
+	if prefix == "" {
+		prefix = "/"
+	}
+	if prefix[0] != '/' {
+		return Hook{}, fmt.Errorf("bad webhook prefix: %s", prefix)
+	}
+
+	if secret == "" {
+		secret = newID()
+	}
+
+	hook := &Hook{
+		ID:        newID(),
+		URL:       hookURL,
+		Prefix:    prefix,
+		Secret:    secret,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.hooks[hook.ID] = hook
+	m.mu.Unlock()
+
+	return *hook, m.save()
+}
+
+// List returns webhooks of the owner without secrets
+func (m *Manager) List(owner string) []Hook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Hook, 0)
+	for _, v := range m.hooks {
+		if v.Owner == owner {
+			hook := *v
+			hook.Secret = ""
+			result = append(result, hook)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+func (m *Manager) Delete(owner string, id string) (bool, error) {
+	m.mu.Lock()
+	hook, ok := m.hooks[id]
+	if ok && hook.Owner == owner {
+		delete(m.hooks, id)
+		delete(m.deliveries, id)
+	}
+	m.mu.Unlock()
+
+	if !ok || hook.Owner != owner {
+		return false, nil
+	}
+
+	return true, m.save()
+}
+
+// Deliveries returns delivery log of the owner's webhook, newest first
+func (m *Manager) Deliveries(owner string, id string) ([]Delivery, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hook, ok := m.hooks[id]
+	if !ok || hook.Owner != owner {
+		return nil, false
+	}
+
+	history := m.deliveries[id]
+	result := make([]Delivery, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		result = append(result, history[i])
+	}
+
+	return result, true
+}
+
+// Run delivers published events until ctx is done
+func (m *Manager) Run(ctx context.Context, bus *events.Bus, workers int) {
+	unsubscribe := bus.Subscribe(m.enqueue)
+	defer unsubscribe()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-m.events:
+				m.dispatch(e)
+			}
+		}
+	}()
+
+	defer m.flush()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.flush()
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case t := <-m.queue:
+					m.deliver(ctx, t)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// enqueue passes the event to dispatch, it's called by the bus and never blocks or takes locks.
+// Reset markers aren't changes and aren't delivered
+func (m *Manager) enqueue(e events.Event) {
+	if e.Type == events.Reset {
+		return
+	}
+
+	select {
+	case m.events <- e:
+	default:
+		log.Printf("webhooks: queue is full, event %d dropped", e.ID)
+	}
+}
+
+// dispatch schedules delivery of the event to matching webhooks
+func (m *Manager) dispatch(e events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.hooks {
+		if !e.Matches(v.Prefix) || !auth.CanAccessAny(v.Owner, e.Path, e.OldPath) {
+			continue
+		}
+
+		select {
+		case m.queue <- task{hook: *v, event: e}:
+		default:
+			log.Printf("webhooks: queue is full, event %d to %s dropped", e.ID, v.URL)
+		}
+	}
+}
+
+func (m *Manager) deliver(ctx context.Context, t task) {
+	d := Delivery{
+		ID:        newID(),
+		HookID:    t.hook.ID,
+		EventID:   t.event.ID,
+		EventType: t.event.Type,
+		Path:      t.event.Path,
+	}
+
+	body, err := json.Marshal(t.event)
+	if err != nil {
+		d.Error = err.Error()
+		m.record(d)
+		return
+	}
+
+	backoff := firstBackoff
+	for d.Attempts < maxAttempts {
+		d.Attempts++
+		d.Time = time.Now()
+		d.StatusCode, err = m.send(ctx, t.hook, d.ID, t.event.Type, body)
+		if err == nil {
+			d.Success = true
+			d.Error = ""
+			break
+		}
+		d.Error = err.Error()
+
+		if d.Attempts == maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			m.record(d)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	m.record(d)
+}
+
+func (m *Manager) send(ctx context.Context, hook Hook, deliveryID string, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(hook.Secret, timestamp, body))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("unexpected status: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (m *Manager) record(d Delivery) {
+	m.mu.Lock()
+	_, ok := m.hooks[d.HookID]
+	if ok {
+		history := append(m.deliveries[d.HookID], d)
+		if len(history) > maxDeliveries {
+			history = history[len(history)-maxDeliveries:]
+		}
+		m.deliveries[d.HookID] = history
+		m.dirty = true
+	}
+	m.mu.Unlock()
+}
+
+// flush saves recorded deliveries when they changed since the last save
+func (m *Manager) flush() {
+	m.mu.Lock()
+	dirty := m.dirty
+	m.mu.Unlock()
+	if !dirty {
+		return
+	}
+
+	if err := m.save(); err != nil {
+		log.Printf("webhooks: can't save deliveries: %v", err)
+	}
+}
+
+// save writes hooks and delivery log to the state file, mu is held only while the state is encoded.
+// Deliveries are marked dirty again when the write fails
+func (m *Manager) save() (err error) {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			m.mu.Lock()
+			m.dirty = true
+			m.mu.Unlock()
+		}
+	}()
+
+	m.mu.Lock()
+	m.dirty = false
+	saved := state{
+		Hooks:      make([]*Hook, 0, len(m.hooks)),
+		Deliveries: m.deliveries,
+	}
+	for _, v := range m.hooks {
+		saved.Hooks = append(saved.Hooks, v)
+	}
+
+	data, err := json.Marshal(saved)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := m.stateFile + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.stateFile)
+}
+
+// Sign returns hex encoded HMAC-SHA256 of the unix timestamp in seconds, a dot and body.
+// Receivers should reject deliveries with timestamps too far from their clock to prevent replays
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkDial refuses connections to addresses which aren't allowed, it's called after host names are resolved
+func (m *Manager) checkDial(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !m.addressAllowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// addressAllowed reports whether webhooks may target addr, only public unicast addresses
+// and addresses inside allowed networks are
+func (m *Manager) addressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, v := range m.allowed {
+		if v.Contains(addr) {
+			return true
+		}
+	}
+
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
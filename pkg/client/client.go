@@ -0,0 +1,148 @@
+// Package client is a Go client for the go-drive REST API.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultMaxRetries = 3
+	DefaultRetryWait  = 250 * time.Millisecond
+)
+
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+	// MaxRetries is a number of retries of idempotent requests failed with network errors or 429, 502, 503, 504
+	MaxRetries int
+	// RetryWait is a delay before the first retry, it doubles for every next one
+	RetryWait time.Duration
+}
+
+// New returns client of the server at baseURL, token may be empty when authentication is disabled
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+		MaxRetries: DefaultMaxRetries,
+		RetryWait:  DefaultRetryWait,
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, endpoint string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.BaseURL + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	return req, nil
+}
+
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends the request and returns response with 2xx status, caller closes its body,
+// requests without body using idempotent methods are retried
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if req.Body == nil && idempotent(req.Method) {
+		retries = c.MaxRetries
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, err := c.HTTPClient.Do(req)
+		if attempt < retries && retryable(resp, err) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(wait):
+			}
+			wait *= 2
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			defer resp.Body.Close()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return nil, &Error{
+				StatusCode: resp.StatusCode,
+				Message:    strings.TrimSpace(string(msg)),
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// call sends request with optional JSON body in and decodes JSON response into out when it is not nil
+func (c *Client) call(ctx context.Context, method string, endpoint string, query url.Values, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(string(data))
+	}
+
+	req, err := c.newRequest(ctx, method, endpoint, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
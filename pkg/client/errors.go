@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors matching server response codes, use errors.Is to check them. Missing paths are reported
+// as ErrNotFound, existing targets and items changed during the operation as ErrConflict
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrResetRequired = errors.New("reset required")
+	ErrTooLarge      = errors.New("request too large")
+	ErrServer        = errors.New("server error")
+)
+
+// Error is returned for responses with non 2xx status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("go-drive: %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns error kind matching the status code
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusGone:
+		return ErrResetRequired
+	case e.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Changes returns changes inside prefix recorded after cursor, empty cursor returns the current one.
+// When the cursor is too old the returned error matches ErrResetRequired.
+func (c *Client) Changes(ctx context.Context, prefix string, cursor string, limit int) (*ChangeSet, error) {
+	query := url.Values{"prefix": {prefix}, "cursor": {cursor}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var set ChangeSet
+	err := c.call(ctx, http.MethodGet, "/changes", query, nil, &set)
+	return &set, err
+}
+
+// Watch streams change events inside prefix to fn until ctx is done or fn returns error.
+// Events after lastEventID are replayed first, zero starts from new events.
+// Event of type EventReset means some changes were lost.
+func (c *Client) Watch(ctx context.Context, prefix string, lastEventID uint64, fn func(Event) error) error {
+	query := url.Values{"prefix": {prefix}}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastEventID, 10))
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if data == "" {
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				return err
+			}
+			if eventType == EventReset {
+				e.Type = EventReset
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+
+			eventType, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(line[len("data:"):])
+		}
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// List returns content of directory
+func (c *Client) List(ctx context.Context, dir string) ([]DirEntry, error) {
+	var entries []DirEntry
+	err := c.call(ctx, http.MethodGet, "/list", url.Values{"path": {dir}}, nil, &entries)
+	return entries, err
+}
+
+// Stat returns information about file or directory, missing items are reported as ErrNotFound
+func (c *Client) Stat(ctx context.Context, p string) (*DirEntry, error) {
+	var entry DirEntry
+	err := c.call(ctx, http.MethodGet, "/stat", url.Values{"path": {path.Clean("/" + p)}}, nil, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Mkdir creates directory
+func (c *Client) Mkdir(ctx context.Context, dir string) error {
+	return c.call(ctx, http.MethodPost, "/directory", url.Values{"path": {dir}}, nil, nil)
+}
+
+// Delete deletes file or directory
+func (c *Client) Delete(ctx context.Context, p string) error {
+	return c.call(ctx, http.MethodDelete, "/delete", url.Values{"path": {p}}, nil, nil)
+}
+
+// transferQuery returns query of copy, move and extract requests
+func transferQuery(dest string, src string, onConflict Conflict) url.Values {
+	query := url.Values{"dest": {dest}, "src": {src}}
+	if onConflict != "" {
+		query.Set("onConflict", string(onConflict))
+	}
+	return query
+}
+
+// Move moves file src into directory dest and returns its final path
+func (c *Client) Move(ctx context.Context, dest string, src string, onConflict Conflict) (*Placement, error) {
+	var placement Placement
+	err := c.call(ctx, http.MethodPut, "/move", transferQuery(dest, src, onConflict), nil, &placement)
+	return &placement, err
+}
+
+// MoveAsync starts background move of file src into directory dest
+func (c *Client) MoveAsync(ctx context.Context, dest string, src string, onConflict Conflict) (*Job, error) {
+	query := transferQuery(dest, src, onConflict)
+	query.Set("async", "true")
+
+	var job Job
+	err := c.call(ctx, http.MethodPut, "/move", query, nil, &job)
+	return &job, err
+}
+
+// Copy copies file src into directory dest and returns final path of the copy
+func (c *Client) Copy(ctx context.Context, dest string, src string, onConflict Conflict) (*Placement, error) {
+	var placement Placement
+	err := c.call(ctx, http.MethodPut, "/copy", transferQuery(dest, src, onConflict), nil, &placement)
+	return &placement, err
+}
+
+// CopyAsync starts background copy of file src into directory dest
+func (c *Client) CopyAsync(ctx context.Context, dest string, src string, onConflict Conflict) (*Job, error) {
+	query := transferQuery(dest, src, onConflict)
+	query.Set("async", "true")
+
+	var job Job
+	err := c.call(ctx, http.MethodPut, "/copy", query, nil, &job)
+	return &job, err
+}
+
+// Extract starts background extraction of zip, tar or tar.gz archive src into directory dest,
+// final paths of extracted files are listed in placements of the finished job
+func (c *Client) Extract(ctx context.Context, dest string, src string, onConflict Conflict) (*Job, error) {
+	var job Job
+	err := c.call(ctx, http.MethodPost, "/extract", transferQuery(dest, src, onConflict), nil, &job)
+	return &job, err
+}
+
+// Archive starts background packing of file or directory src into zip archive dest
+func (c *Client) Archive(ctx context.Context, dest string, src string) (*Job, error) {
+	var job Job
+	err := c.call(ctx, http.MethodPost, "/archive", url.Values{"dest": {dest}, "src": {src}}, nil, &job)
+	return &job, err
+}
+
+// sendFile streams r as multipart form file named name and decodes JSON response into out unless it's nil
+func (c *Client) sendFile(ctx context.Context, method string, endpoint string, query url.Values, name string, r io.Reader, out any) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := c.newRequest(ctx, method, endpoint, query, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := c.do(req)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Upload streams r into a new file at p and returns its final path
+func (c *Client) Upload(ctx context.Context, p string, r io.Reader, onConflict Conflict) (*Placement, error) {
+	p = path.Clean("/" + p)
+	query := url.Values{"path": {path.Dir(p)}}
+	if onConflict != "" {
+		query.Set("onConflict", string(onConflict))
+	}
+
+	var placement Placement
+	err := c.sendFile(ctx, http.MethodPost, "/upload", query, path.Base(p), r, &placement)
+	return &placement, err
+}
+
+// Update streams r as new content of existing file at p
+func (c *Client) Update(ctx context.Context, p string, r io.Reader) error {
+	return c.sendFile(ctx, http.MethodPut, "/update", url.Values{"path": {p}}, path.Base(p), r, nil)
+}
+
+// Download writes content of file at p into w
+func (c *Client) Download(ctx context.Context, p string, w io.Writer) error {
+	return c.DownloadRange(ctx, p, w, 0, -1)
+}
+
+// DownloadRange writes length bytes of file at p starting from offset into w,
+// negative length means up to the end of file. Transfers interrupted after some progress are resumed.
+func (c *Client) DownloadRange(ctx context.Context, p string, w io.Writer, offset int64, length int64) error {
+	var written int64
+	wait := c.RetryWait
+
+	for attempt := 0; ; attempt++ {
+		n, err := c.downloadRange(ctx, p, w, offset+written, length, written)
+		written += n
+		if err == nil || n == 0 || attempt >= c.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) downloadRange(ctx context.Context, p string, w io.Writer, offset int64, length int64, written int64) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/download", url.Values{"path": {p}}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if length >= 0 {
+		if length-written <= 0 {
+			return 0, nil
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-written-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if req.Header.Get("Range") != "" && resp.StatusCode != http.StatusPartialContent {
+		return 0, &Error{
+			StatusCode: resp.StatusCode,
+			Message:    "range requests are not supported",
+		}
+	}
+
+	return io.Copy(w, resp.Body)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Jobs returns jobs started by the caller, newest first
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	err := c.call(ctx, http.MethodGet, "/jobs", nil, nil, &jobs)
+	return jobs, err
+}
+
+// Job returns state of the job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	err := c.call(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &job)
+	return &job, err
+}
+
+// CancelJob requests cancellation of the running job
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	err := c.call(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, nil, &job)
+	return &job, err
+}
+
+// WaitJob polls the job every interval until it is done
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
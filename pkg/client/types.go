@@ -0,0 +1,132 @@
+package client
+
+import (
+	"time"
+)
+
+// DirEntry types
+const (
+	TypeFile = "file"
+	TypeDir  = "dir"
+)
+
+// DirEntry represents file/directory information
+type DirEntry struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ContentType string    `json:"contentType,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
+}
+
+func (e DirEntry) IsDir() bool { return e.Type == TypeDir }
+
+// Conflict selects what happens when the target of upload, copy, move or extract already exists,
+// empty policy means ConflictFail
+type Conflict string
+
+// Conflict policies
+const (
+	ConflictFail      Conflict = "fail"
+	ConflictOverwrite Conflict = "overwrite"
+	ConflictRename    Conflict = "rename"
+	ConflictSkip      Conflict = "skip"
+)
+
+// Placement is the final path of a written file, Skipped means the existing file was kept
+// and Overwritten means its content was replaced
+type Placement struct {
+	Path        string `json:"path"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Overwritten bool   `json:"overwritten,omitempty"`
+}
+
+// Job statuses
+const (
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobCanceled    = "canceled"
+	JobInterrupted = "interrupted"
+)
+
+// Progress of a running job
+type Progress struct {
+	Bytes int64 `json:"bytes"`
+	Items int64 `json:"items"`
+}
+
+// Job represents state of a background operation, Placements lists final paths of written files
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Owner      string      `json:"owner,omitempty"`
+	Status     string      `json:"status"`
+	Progress   Progress    `json:"progress"`
+	Result     string      `json:"result,omitempty"`
+	Placements []Placement `json:"placements,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// Done reports whether the job is not running anymore
+func (j *Job) Done() bool { return j.Status != JobRunning }
+
+// Event types
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventMoved   = "moved"
+	EventCopied  = "copied"
+	// EventReset means some events were lost and the tree has to be relisted
+	EventReset = "reset"
+)
+
+// Event describes a change of a storage item
+type Event struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	ItemType string    `json:"itemType"`
+	Path     string    `json:"path"`
+	OldPath  string    `json:"oldPath,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Size     int64     `json:"size"`
+	External bool      `json:"external,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ChangeSet is a page of the change journal
+type ChangeSet struct {
+	Changes       []Event `json:"changes"`
+	Cursor        string  `json:"cursor"`
+	HasMore       bool    `json:"hasMore"`
+	ResetRequired bool    `json:"resetRequired,omitempty"`
+}
+
+// Webhook is a registered webhook receiving events for paths inside Prefix
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Prefix    string    `json:"prefix"`
+	Secret    string    `json:"secret,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Delivery is a webhook delivery log record
+type Delivery struct {
+	ID         string    `json:"id"`
+	HookID     string    `json:"hookId"`
+	EventID    uint64    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	Path       string    `json:"path"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	Time       time.Time `json:"time"`
+}
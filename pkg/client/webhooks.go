@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type webhookRequest struct {
+	URL    string `json:"url"`
+	Prefix string `json:"prefix"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// CreateWebhook registers webhook for changes inside prefix, server generates secret when it is empty.
+// Returned webhook contains the secret used to sign deliveries.
+func (c *Client) CreateWebhook(ctx context.Context, hookURL string, prefix string, secret string) (*Webhook, error) {
+	var hook Webhook
+	err := c.call(ctx, http.MethodPost, "/webhooks", nil, webhookRequest{URL: hookURL, Prefix: prefix, Secret: secret}, &hook)
+	return &hook, err
+}
+
+// Webhooks returns webhooks registered by the caller
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	err := c.call(ctx, http.MethodGet, "/webhooks", nil, nil, &hooks)
+	return hooks, err
+}
+
+// DeleteWebhook deletes webhook
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Deliveries returns delivery log of webhook, newest first
+func (c *Client) Deliveries(ctx context.Context, id string) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := c.call(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(id)+"/deliveries", nil, nil, &deliveries)
+	return deliveries, err
+}